@@ -5,13 +5,16 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/api"
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/auth"
 	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/db"
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/groups"
 	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/mastery"
 )
 
@@ -37,9 +40,40 @@ func main() {
 	
 	defer conn.Close()
 
-	service := mastery.NewMasteryService(conn)
+	//one client so the codeforces rate limit is shared between sync and handle verification
+	cf := mastery.NewCFClient()
+	service := mastery.NewMasteryServiceWithClient(conn, cf)
 
-	h := &api.Handler{Conn: conn, Service: service}
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" { appURL = "http://localhost:5173/login" }
+	authService := auth.NewAuthService(conn, newMailer(), cf, appURL)
+
+	requireVerified, _ := strconv.ParseBool(os.Getenv("REQUIRE_VERIFIED_HANDLES"))
+	if !requireVerified {
+		log.Print("REQUIRE_VERIFIED_HANDLES is off: anyone can sync and submit for any handle")
+	}
+
+	h := &api.Handler{Conn: conn, Service: service, Auth: authService, Groups: groups.NewGroupService(conn, service)}
+
+	//picks up new problems, re-ratings, re-tags and solve counts from codeforces, once at boot
+	//and then every 12 hours
+	go func() {
+		refresh := func() {
+			summary, err := service.RefreshProblemset()
+			if err != nil {
+				log.Printf("problemset refresh failed: %v", err)
+				return
+			}
+			log.Printf("problemset refresh: %d new, %d updated, %d users rebuilt", summary.Inserted, summary.Updated, summary.RebuiltUsers)
+		}
+		refresh()
+
+		ticker := time.NewTicker(12 * time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			refresh()
+		}
+	}()
 
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
@@ -48,24 +82,102 @@ func main() {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins: []string{"http://localhost:5173", "https://tanaydonde.github.io"},
 		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders: []string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding"},
-		ExposedHeaders: []string{"Link"},
+		AllowedHeaders: []string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "Authorization"},
+		ExposedHeaders: []string{"Link", "X-Next-Cursor"},
 		AllowCredentials: true,
 		MaxAge: 300,
 	}))
 
+	r.Use(auth.RequireJSONBody)
+	r.Use(authService.Middleware)
+
 	r.Route("/api", func(r chi.Router) {
-		r.Get("/problems/{topic}", h.GetProblemsByTopic) // /api/problems/{topic}?handle=[handle]&inc=[inc]
+		r.Post("/auth/register", h.RegisterHandler)
+		r.Post("/auth/login", h.LoginHandler)
+		r.Post("/auth/magic-link", h.MagicLinkHandler)
+		r.Post("/auth/magic-link/verify", h.VerifyMagicLinkHandler)
+		r.Post("/auth/logout", h.LogoutHandler)
+		r.With(auth.RequireUser).Get("/auth/me", h.MeHandler)
+		r.With(auth.RequireUser).Post("/auth/handles", h.BindHandleHandler) // body {handle, method: compile|name}
+		r.With(authService.RequireHandleOwner).Post("/auth/handles/{handle}/verify", h.VerifyHandleHandler)
+		r.With(auth.RequireUser).Delete("/auth/handles/{handle}", h.UnbindHandleHandler)
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequireUser)
+			r.Post("/groups", h.CreateGroupHandler) // body {name, handle?}
+			r.Get("/groups", h.ListGroupsHandler)
+			r.Post("/groups/join", h.JoinGroupHandler) // body {token, handle?}
+			r.Get("/groups/{id}", h.GetGroupHandler)
+			r.Post("/groups/{id}/invites", h.CreateInviteHandler) // body {role: member|coach}
+			r.Get("/groups/{id}/stats", h.GetGroupStatsHandler)
+			// /api/groups/{id}/leaderboard?metric=[topic|overall|solves]&topic=[topic]&window=[days]
+			r.Get("/groups/{id}/leaderboard", h.GetLeaderboardHandler)
+			r.Post("/groups/{id}/assignments", h.CreateAssignmentHandler) // body {title, problems, due_at, handles?}
+			r.Get("/groups/{id}/assignments", h.ListAssignmentsHandler)
+			r.Get("/groups/{id}/assignments/{assignmentId}", h.GetAssignmentOverviewHandler)
+			// /api/groups/{id}/problems/{topic}?target=[min|mean|max] plus the /problems/{topic} params except handle
+			r.Get("/groups/{id}/problems/{topic}", h.GetGroupProblemsHandler)
+		})
+
+		// /api/problems?q=[text]&tags=[t1,t2]&min=[r]&max=[r]&solved_by=[handle]&unsolved_by=[handle]
+		//     &handle=[handle]&sort=[newest|oldest|rating|-rating|popular]&cursor=[cursor]&limit=[n]
+		r.Get("/problems", h.SearchProblemsHandler)
+		// /api/problems/{topic}?handle=[handle]&inc=[inc]&diversity=[0..1]&topics=[t1,t2]&mode=[all|any]
+		//     &k=[k]&min_rating=[r]&max_rating=[r]&cursor=[cursor]&exclude_tags=[t1,t2]
+		//     &division=[div1,div2,...]&since=[year]&index=[A,B]&estimated=[true|false]&lang=[en|ru|any]
+		r.Get("/problems/{topic}", h.GetProblemsByTopic)
 		r.Get("/daily", h.GetDailyHandler)
 		r.Get("/graph", h.GetGraphHandler)
 		r.Get("/stats/{handle}", h.GetUserStats)
+		r.Get("/stats/{handle}/verdicts", h.GetVerdictStatsHandler)
+		r.Get("/compare", h.CompareHandler) // /api/compare?handles=[a,b,c]&limit=[n]
 		r.Get("/recent/solved/{handle}", h.GetRecentSolvedHandler)
 		r.Get("/recent/unsolved/{handle}", h.GetRecentUnsolvedHandler)
-		r.Post("/sync/{handle}", h.SyncUserHandler)
-		r.Post("/submit/{handle}", h.SubmitProblemHandler)
+		r.Get("/upsolve/{handle}", h.GetUpsolveHandler) // /api/upsolve/{handle}?k=[k]
+		// timeSpentMinutes on a solve: a virtual contest, then a solve session, then a real contest,
+		// then the minutes reported on submit. contest solves count from the previous accepted problem
+		// in the same participation (the first from the start), not from the start, capped at 240
+		r.Get("/solves/{handle}", h.GetSolvesHandler)
+		r.Get("/virtual-contest/{handle}", h.ListVirtualContestsHandler)
+		r.Get("/virtual-contest/{handle}/{id}", h.GetVirtualContestHandler)
+		r.Get("/sessions/{handle}", h.ListSessionsHandler)
+
+		//mutating a handle's data requires a verified binding; an unverified claim proves nothing.
+		//off unless REQUIRE_VERIFIED_HANDLES=true, until every client logs in and binds its handle
+		r.Group(func(r chi.Router) {
+			if requireVerified {
+				r.Use(authService.RequireVerifiedHandle)
+			}
+			r.Post("/sync/{handle}", h.SyncUserHandler)
+			r.Post("/submit/{handle}", h.SubmitProblemHandler) // body {problem_id, time_spent_minutes?}; timed like /solves
+			r.Delete("/submit/{handle}/{problemId}", h.DeleteSolveHandler)
+			r.Delete("/solves/{handle}/{problemId}", h.DeleteSolveHandler)
+			r.Post("/virtual-contest/{handle}", h.CreateVirtualContestHandler) // body {topics?, k?, duration_minutes?}; scored on sync
+			r.Post("/sessions/{handle}", h.StartSessionHandler) // body {problem_id}; closed by sync at the accepted submission
+			r.Post("/sessions/{handle}/{id}/pause", h.PauseSessionHandler)
+			r.Post("/sessions/{handle}/{id}/resume", h.ResumeSessionHandler)
+			r.Delete("/sessions/{handle}/{id}", h.CancelSessionHandler)
+		})
 	})
 
 	port := os.Getenv("PORT")
 	if port == "" { port = "8080" }
 	log.Fatal(http.ListenAndServe("0.0.0.0:"+port, r))
 }
+
+//login links only go to the local sink in dev (APP_ENV=dev). anywhere else they need smtp, and
+//without it magic links are turned off and only password login works
+func newMailer() auth.Mailer {
+	if os.Getenv("APP_ENV") == "dev" {
+		return auth.SinkMailer{Dir: os.Getenv("MAIL_SINK_DIR")}
+	}
+	host := os.Getenv("SMTP_HOST")
+	from := os.Getenv("MAIL_FROM")
+	if host == "" || from == "" {
+		log.Print("SMTP_HOST or MAIL_FROM not set: magic-link login is disabled")
+		return nil
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" { port = "587" }
+	return auth.SMTPMailer{Host: host, Port: port, User: os.Getenv("SMTP_USER"), Password: os.Getenv("SMTP_PASSWORD"), From: from}
+}
\ No newline at end of file
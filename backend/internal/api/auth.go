@@ -0,0 +1,225 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/auth"
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/mastery"
+)
+
+type credentialsInput struct {
+	Email string `json:"email"`
+	Password string `json:"password"`
+}
+
+//hands the session back both as a cookie and in the body for clients using bearer tokens.
+//lax keeps the cookie off cross-site posts; a frontend on another site sends the bearer token
+func (h *Handler) writeSession(w http.ResponseWriter, token string) {
+	http.SetCookie(w, sessionCookie(token, time.Now().Add(30 * 24 * time.Hour)))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"token": token})
+}
+
+func sessionCookie(token string, expires time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name: auth.SessionCookie,
+		Value: token,
+		Path: "/",
+		Expires: expires,
+		HttpOnly: true,
+		Secure: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (h *Handler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
+	var input credentialsInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Email == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(input.Password) < 8 {
+		http.Error(w, "password must be at least 8 characters", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.Auth.Register(input.Email, input.Password)
+	if errors.Is(err, auth.ErrInvalidEmail) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, auth.ErrEmailTaken) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	h.writeSession(w, token)
+}
+
+func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	var input credentialsInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.Auth.Login(input.Email, input.Password)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	h.writeSession(w, token)
+}
+
+func (h *Handler) MagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var input credentialsInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Email == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := h.Auth.SendMagicLink(input.Email)
+	if errors.Is(err, auth.ErrInvalidEmail) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, auth.ErrMagicLinkDisabled) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to send login link", 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "sent"})
+}
+
+func (h *Handler) VerifyMagicLinkHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token, err := h.Auth.VerifyMagicLink(input.Token)
+	if errors.Is(err, auth.ErrInvalidToken) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	h.writeSession(w, token)
+}
+
+func (h *Handler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if token := auth.TokenFromRequest(r); token != "" {
+		if err := h.Auth.Logout(token); err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+	}
+	c := sessionCookie("", time.Unix(0, 0))
+	c.MaxAge = -1
+	http.SetCookie(w, c)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) MeHandler(w http.ResponseWriter, r *http.Request) {
+	u := auth.UserFromContext(r.Context())
+	user, err := h.Auth.GetUser(u.ID)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func (h *Handler) BindHandleHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Handle string `json:"handle"`
+		Method string `json:"method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Handle == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if input.Method == "" {
+		input.Method = "compile"
+	}
+
+	u := auth.UserFromContext(r.Context())
+	challenge, err := h.Auth.BindHandle(u.ID, input.Handle, input.Method)
+	if errors.Is(err, mastery.ErrHandleNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, auth.ErrUnknownMethod) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, auth.ErrHandleTaken) || errors.Is(err, auth.ErrAlreadyVerified) || errors.Is(err, auth.ErrChallengePending) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(challenge)
+}
+
+func (h *Handler) VerifyHandleHandler(w http.ResponseWriter, r *http.Request) {
+	u := auth.UserFromContext(r.Context())
+	err := h.Auth.VerifyHandle(u.ID, chi.URLParam(r, "handle"))
+	switch {
+	case errors.Is(err, auth.ErrHandleNotOwned):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, auth.ErrAlreadyVerified):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, auth.ErrChallengeExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+		return
+	case errors.Is(err, auth.ErrChallengeNotMet):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "verified"})
+}
+
+func (h *Handler) UnbindHandleHandler(w http.ResponseWriter, r *http.Request) {
+	u := auth.UserFromContext(r.Context())
+	err := h.Auth.UnbindHandle(u.ID, chi.URLParam(r, "handle"))
+	if errors.Is(err, auth.ErrHandleNotOwned) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,255 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/auth"
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/groups"
+)
+
+//maps group service errors to status codes, writing a 500 for anything unexpected
+func writeGroupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, groups.ErrGroupNotFound), errors.Is(err, groups.ErrAssignmentNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, groups.ErrNotMember), errors.Is(err, groups.ErrNotCoach), errors.Is(err, groups.ErrHandleNotVerified):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, groups.ErrInvalidInvite), errors.Is(err, groups.ErrInvalidRole),
+		errors.Is(err, groups.ErrInvalidMetric), errors.Is(err, groups.ErrTopicRequired),
+		errors.Is(err, groups.ErrNoProblems), errors.Is(err, groups.ErrNoMemberHandles), errors.Is(err, groups.ErrInvalidTarget), errors.Is(err, groups.ErrUnknownProblem), errors.Is(err, groups.ErrNotGroupHandle):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), 500)
+	}
+}
+
+func groupIDParam(r *http.Request) (int, error) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid group id")
+	}
+	return id, nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func (h *Handler) CreateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+		Handle string `json:"handle"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Name == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	u := auth.UserFromContext(r.Context())
+	g, err := h.Groups.CreateGroup(u.ID, input.Name, input.Handle)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+	writeJSON(w, g)
+}
+
+func (h *Handler) ListGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	u := auth.UserFromContext(r.Context())
+	gs, err := h.Groups.ListGroups(u.ID)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+	writeJSON(w, gs)
+}
+
+func (h *Handler) GetGroupHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, err := groupIDParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	u := auth.UserFromContext(r.Context())
+	g, err := h.Groups.GetGroup(u.ID, groupID)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+	writeJSON(w, g)
+}
+
+func (h *Handler) CreateInviteHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, err := groupIDParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var input struct {
+		Role string `json:"role"`
+	}
+	//the body is optional; an empty one invites a plain member
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	u := auth.UserFromContext(r.Context())
+	inv, err := h.Groups.CreateInvite(u.ID, groupID, input.Role)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+	writeJSON(w, inv)
+}
+
+func (h *Handler) JoinGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+		Handle string `json:"handle"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	u := auth.UserFromContext(r.Context())
+	g, err := h.Groups.Join(u.ID, input.Token, input.Handle)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+	writeJSON(w, g)
+}
+
+func (h *Handler) GetGroupStatsHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, err := groupIDParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	u := auth.UserFromContext(r.Context())
+	stats, err := h.Groups.GetGroupStats(u.ID, groupID)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+	writeJSON(w, stats)
+}
+
+func (h *Handler) GetLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, err := groupIDParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		metric = "overall"
+	}
+	window, err := queryInt(r, "window", 30, 1, 365)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	u := auth.UserFromContext(r.Context())
+	board, err := h.Groups.GetLeaderboard(u.ID, groupID, metric, r.URL.Query().Get("topic"), window)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+	writeJSON(w, board)
+}
+
+func (h *Handler) CreateAssignmentHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, err := groupIDParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var input groups.AssignmentInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Title == "" || input.DueAt.IsZero() {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	u := auth.UserFromContext(r.Context())
+	a, err := h.Groups.CreateAssignment(u.ID, groupID, input)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+	writeJSON(w, a)
+}
+
+func (h *Handler) ListAssignmentsHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, err := groupIDParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	u := auth.UserFromContext(r.Context())
+	as, err := h.Groups.ListAssignments(u.ID, groupID)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+	writeJSON(w, as)
+}
+
+func (h *Handler) GetAssignmentOverviewHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, err := groupIDParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	assignmentID, err := strconv.Atoi(chi.URLParam(r, "assignmentId"))
+	if err != nil || assignmentID <= 0 {
+		http.Error(w, "invalid assignment id", http.StatusBadRequest)
+		return
+	}
+
+	u := auth.UserFromContext(r.Context())
+	ov, err := h.Groups.GetAssignmentOverview(u.ID, groupID, assignmentID)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+	writeJSON(w, ov)
+}
+
+func (h *Handler) GetGroupProblemsHandler(w http.ResponseWriter, r *http.Request) {
+	groupID, err := groupIDParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	topics, opts, err := parseRecommendOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.GroupTarget = r.URL.Query().Get("target")
+	if opts.GroupTarget == "" {
+		opts.GroupTarget = "mean"
+	}
+
+	u := auth.UserFromContext(r.Context())
+	recommendations, err := h.Groups.RecommendForGroup(u.ID, groupID, topics, opts)
+	if err != nil {
+		writeGroupError(w, err)
+		return
+	}
+	writeRecommendations(w, recommendations, opts)
+}
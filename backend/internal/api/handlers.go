@@ -2,11 +2,15 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/auth"
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/groups"
 	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/mastery"
 	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/models"
 )
@@ -14,6 +18,8 @@ import (
 type Handler struct {
     Conn *pgxpool.Pool
     Service *mastery.MasteryService
+    Auth *auth.AuthService
+    Groups *groups.GroupService
 }
 
 func (h *Handler) GetGraphHandler(w http.ResponseWriter, r *http.Request) {
@@ -26,7 +32,12 @@ func (h *Handler) GetGraphHandler(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) SyncUserHandler(w http.ResponseWriter, r *http.Request) {
     handle := chi.URLParam(r, "handle")
-    if err := h.Service.Sync(handle); err != nil {
+    err := h.Service.Sync(handle)
+    if errors.Is(err, mastery.ErrHandleNotFound) {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
         http.Error(w, err.Error(), 500)
         return
     }
@@ -46,10 +57,64 @@ func (h *Handler) GetUserStats(w http.ResponseWriter, r *http.Request) {
     json.NewEncoder(w).Encode(stats)
 }
 
+func (h *Handler) CompareHandler(w http.ResponseWriter, r *http.Request) {
+	handles := queryList(r, "handles")
+	if len(handles) < 2 || len(handles) > 5 {
+		http.Error(w, "handles must list between 2 and 5 handles", http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(r, "limit", 20, 1, 100)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cmp, err := h.Service.CompareHandles(handles, limit)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cmp)
+}
+
 func (h *Handler) GetProblemsByTopic(w http.ResponseWriter, r *http.Request) {
-	topic := chi.URLParam(r, "topic")
 	handle := r.URL.Query().Get("handle")
 
+	topics, opts, err := parseRecommendOptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recommendations, err := h.Service.RecommendProblem(handle, topics, opts)
+	if err != nil {
+		http.Error(w, "failed to get problems: " + err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeRecommendations(w, recommendations, opts)
+}
+
+//reads the {topic} route param and the recommendation query params shared by the handle and group recommenders
+func parseRecommendOptions(r *http.Request) ([]string, mastery.RecommendOptions, error) {
+	var opts mastery.RecommendOptions
+	topic := chi.URLParam(r, "topic")
+
+	topics := []string{topic}
+	for _, t := range queryList(r, "topics") {
+		if t != topic {
+			topics = append(topics, t)
+		}
+	}
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = "all"
+	}
+	if mode != "all" && mode != "any" {
+		return nil, opts, errors.New("mode must be 'all' or 'any'")
+	}
+
 	targetInc := 25
 	if incStr := r.URL.Query().Get("inc"); incStr != "" {
 		if val, err := strconv.Atoi(incStr); err == nil {
@@ -57,14 +122,73 @@ func (h *Handler) GetProblemsByTopic(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	limit := 5
+	diversity, err := queryFloat(r, "diversity", 0.3, 0, 1)
+	if err != nil {
+		return nil, opts, err
+	}
+
+	limit, err := queryInt(r, "k", 5, 1, 50)
+	if err != nil {
+		return nil, opts, err
+	}
+
+	minRating, err := queryInt(r, "min_rating", 0, 0, 4000)
+	if err != nil {
+		return nil, opts, err
+	}
+
+	maxRating, err := queryInt(r, "max_rating", 0, 0, 4000)
+	if err != nil {
+		return nil, opts, err
+	}
+	if minRating > 0 && maxRating > 0 && minRating > maxRating {
+		return nil, opts, errors.New("min_rating must not exceed max_rating")
+	}
+
+	//the cursor is the offset into the ranked list, handed back in X-Next-Cursor
+	offset, err := queryInt(r, "cursor", 0, 0, 1000)
+	if err != nil {
+		return nil, opts, err
+	}
+
+	excludeTags := queryList(r, "exclude_tags")
+	for _, tag := range excludeTags {
+		for _, t := range topics {
+			if tag == t {
+				return nil, opts, errors.New("exclude_tags cannot contain a requested topic")
+			}
+		}
+	}
 	
-	recommendations, err := h.Service.RecommendProblem(handle, topic, targetInc, limit)
+	includeEstimated, err := queryBool(r, "estimated", true)
 	if err != nil {
-		http.Error(w, "failed to get problems: " + err.Error(), http.StatusInternalServerError)
-		return
+		return nil, opts, err
 	}
 
+	//russian-only statements were never recommended before, so they stay opt-in
+	filter, err := parseProblemFilter(r, "en")
+	if err != nil {
+		return nil, opts, err
+	}
+
+	return topics, mastery.RecommendOptions{
+		TargetInc: targetInc,
+		K: limit,
+		Diversity: diversity,
+		Mode: mode,
+		MinRating: minRating,
+		MaxRating: maxRating,
+		Offset: offset,
+		ExcludeTags: excludeTags,
+		ExcludeEstimated: !includeEstimated,
+		Filter: filter,
+	}, nil
+}
+
+func writeRecommendations(w http.ResponseWriter, recommendations []mastery.CFProblemOutput, opts mastery.RecommendOptions) {
+	if len(recommendations) == opts.K {
+		w.Header().Set("X-Next-Cursor", strconv.Itoa(opts.Offset+opts.K))
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(recommendations)
 }
@@ -131,4 +255,316 @@ func (h *Handler) GetRecentUnsolvedHandler(w http.ResponseWriter, r *http.Reques
 
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(solves)
-}
\ No newline at end of file
+}
+
+func (h *Handler) GetUpsolveHandler(w http.ResponseWriter, r *http.Request) {
+    handle := chi.URLParam(r, "handle")
+    if handle == "" {
+        http.Error(w, "handle required", 400)
+        return
+    }
+
+    k, err := queryInt(r, "k", 20, 1, 100)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    queue, err := h.Service.GetUpsolveQueue(handle, k)
+    if errors.Is(err, mastery.ErrHandleNotFound) {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        http.Error(w, "failed to build upsolve queue: " + err.Error(), 500)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(queue)
+}
+
+func (h *Handler) SearchProblemsHandler(w http.ResponseWriter, r *http.Request) {
+	q := mastery.CatalogQuery{
+		Text: r.URL.Query().Get("q"),
+		Tags: queryList(r, "tags"),
+		SolvedBy: r.URL.Query().Get("solved_by"),
+		UnsolvedBy: r.URL.Query().Get("unsolved_by"),
+		Handle: r.URL.Query().Get("handle"),
+		Sort: r.URL.Query().Get("sort"),
+		Cursor: r.URL.Query().Get("cursor"),
+	}
+	if q.Sort == "" {
+		q.Sort = "newest"
+	}
+	if !mastery.IsCatalogSort(q.Sort) {
+		http.Error(w, "sort must be one of newest, oldest, rating, -rating, popular", http.StatusBadRequest)
+		return
+	}
+	if q.Handle == "" {
+		q.Handle = q.SolvedBy
+	}
+	if q.Handle == "" {
+		q.Handle = q.UnsolvedBy
+	}
+
+	var err error
+	if q.MinRating, err = queryInt(r, "min", 0, 0, 4000); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.MaxRating, err = queryInt(r, "max", 0, 0, 4000); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.MinRating > 0 && q.MaxRating > 0 && q.MinRating > q.MaxRating {
+		http.Error(w, "min must not exceed max", http.StatusBadRequest)
+		return
+	}
+	if q.Limit, err = queryInt(r, "limit", 25, 1, 100); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Filter, err = parseProblemFilter(r, ""); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	problems, next, err := h.Service.SearchProblems(q)
+	if errors.Is(err, mastery.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "failed to search problems: " + err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(problems)
+}
+
+func (h *Handler) GetSolvesHandler(w http.ResponseWriter, r *http.Request) {
+    handle := chi.URLParam(r, "handle")
+    if handle == "" {
+        http.Error(w, "handle required", 400)
+        return
+    }
+
+    events, err := h.Service.ListSolves(handle)
+    if err != nil {
+        http.Error(w, "failed to fetch solves", 500)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(events)
+}
+
+func (h *Handler) DeleteSolveHandler(w http.ResponseWriter, r *http.Request) {
+    handle := chi.URLParam(r, "handle")
+    problemID := chi.URLParam(r, "problemId")
+
+    err := h.Service.DeleteSolve(handle, problemID)
+    if errors.Is(err, mastery.ErrSolveNotFound) {
+        http.Error(w, err.Error(), http.StatusNotFound)
+        return
+    }
+    if err != nil {
+        http.Error(w, err.Error(), 500)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(map[string]string{"status": "deleted"})
+}
+
+func (h *Handler) GetVerdictStatsHandler(w http.ResponseWriter, r *http.Request) {
+    handle := chi.URLParam(r, "handle")
+
+    stats, err := h.Service.GetVerdictStats(handle)
+    if err != nil {
+        http.Error(w, err.Error(), 500)
+        return
+    }
+
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(stats)
+}
+func (h *Handler) CreateVirtualContestHandler(w http.ResponseWriter, r *http.Request) {
+	handle := chi.URLParam(r, "handle")
+
+	var input struct {
+		Topics []string `json:"topics"`
+		K int `json:"k"`
+		DurationMinutes int `json:"duration_minutes"`
+	}
+	//the body is optional; an empty one gives 6 problems over 2 hours in the weakest topics
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if input.K == 0 {
+		input.K = 6
+	}
+	if input.K < 5 || input.K > 7 {
+		http.Error(w, "k must be between 5 and 7", http.StatusBadRequest)
+		return
+	}
+	if input.DurationMinutes == 0 {
+		input.DurationMinutes = 120
+	}
+	if input.DurationMinutes < 30 || input.DurationMinutes > 300 {
+		http.Error(w, "duration_minutes must be between 30 and 300", http.StatusBadRequest)
+		return
+	}
+
+	contest, err := h.Service.CreateVirtualContest(handle, mastery.VirtualContestOptions{
+		Topics: input.Topics,
+		K: input.K,
+		Duration: time.Duration(input.DurationMinutes) * time.Minute,
+	})
+	if errors.Is(err, mastery.ErrContestRunning) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if errors.Is(err, mastery.ErrUnknownTopic) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contest)
+}
+
+func (h *Handler) ListVirtualContestsHandler(w http.ResponseWriter, r *http.Request) {
+	handle := chi.URLParam(r, "handle")
+
+	contests, err := h.Service.ListVirtualContests(handle)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contests)
+}
+
+func (h *Handler) GetVirtualContestHandler(w http.ResponseWriter, r *http.Request) {
+	handle := chi.URLParam(r, "handle")
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid contest id", http.StatusBadRequest)
+		return
+	}
+
+	contest, err := h.Service.GetVirtualContest(handle, id)
+	if errors.Is(err, mastery.ErrContestNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(contest)
+}
+
+func (h *Handler) StartSessionHandler(w http.ResponseWriter, r *http.Request) {
+	handle := chi.URLParam(r, "handle")
+
+	var input struct {
+		ProblemID string `json:"problem_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.ProblemID == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.Service.StartSession(handle, input.ProblemID)
+	if errors.Is(err, mastery.ErrAlreadySolved) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+func (h *Handler) PauseSessionHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeSession(w, r, h.Service.PauseSession)
+}
+
+func (h *Handler) ResumeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	h.changeSession(w, r, h.Service.ResumeSession)
+}
+
+func (h *Handler) changeSession(w http.ResponseWriter, r *http.Request, change func(string, int) (mastery.SolveSession, error)) {
+	handle := chi.URLParam(r, "handle")
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid session id", http.StatusBadRequest)
+		return
+	}
+
+	session, err := change(handle, id)
+	if errors.Is(err, mastery.ErrSessionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+func (h *Handler) CancelSessionHandler(w http.ResponseWriter, r *http.Request) {
+	handle := chi.URLParam(r, "handle")
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil || id <= 0 {
+		http.Error(w, "invalid session id", http.StatusBadRequest)
+		return
+	}
+
+	err = h.Service.CancelSession(handle, id)
+	if errors.Is(err, mastery.ErrSessionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	handle := chi.URLParam(r, "handle")
+
+	sessions, err := h.Service.ListSessions(handle)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
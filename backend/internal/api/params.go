@@ -0,0 +1,111 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/mastery"
+)
+
+//reads an optional integer query parameter, falling back to def when absent
+func queryInt(r *http.Request, name string, def int, lo int, hi int) (int, error) {
+	str := r.URL.Query().Get(name)
+	if str == "" {
+		return def, nil
+	}
+	val, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", name)
+	}
+	if val < lo || val > hi {
+		return 0, fmt.Errorf("%s must be between %d and %d", name, lo, hi)
+	}
+	return val, nil
+}
+
+func queryFloat(r *http.Request, name string, def float64, lo float64, hi float64) (float64, error) {
+	str := r.URL.Query().Get(name)
+	if str == "" {
+		return def, nil
+	}
+	val, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be a number", name)
+	}
+	if val < lo || val > hi {
+		return 0, fmt.Errorf("%s must be between %g and %g", name, lo, hi)
+	}
+	return val, nil
+}
+
+func queryBool(r *http.Request, name string, def bool) (bool, error) {
+	str := r.URL.Query().Get(name)
+	if str == "" {
+		return def, nil
+	}
+	val, err := strconv.ParseBool(str)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", name)
+	}
+	return val, nil
+}
+
+//splits a comma separated query parameter, dropping blanks and duplicates
+func queryList(r *http.Request, name string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(r.URL.Query().Get(name), ",") {
+		item = strings.TrimSpace(item)
+		if item != "" && !seen[item] {
+			out = append(out, item)
+			seen[item] = true
+		}
+	}
+	return out
+}
+
+//reads division, since, index and lang into a problem filter. defLang applies when lang is absent
+func parseProblemFilter(r *http.Request, defLang string) (mastery.ProblemFilter, error) {
+	var f mastery.ProblemFilter
+
+	switch lang := r.URL.Query().Get("lang"); lang {
+	case "":
+		f.Lang = defLang
+	case "en", "ru":
+		f.Lang = lang
+	case "any":
+		f.Lang = ""
+	default:
+		return f, fmt.Errorf("lang must be en, ru or any")
+	}
+
+	valid := make(map[string]bool, len(mastery.Divisions))
+	for _, d := range mastery.Divisions {
+		valid[d] = true
+	}
+	for _, d := range queryList(r, "division") {
+		d = strings.ToLower(d)
+		if !valid[d] {
+			return f, fmt.Errorf("unknown division %q", d)
+		}
+		f.Divisions = append(f.Divisions, d)
+	}
+
+	year, err := queryInt(r, "since", 0, 2010, 2100)
+	if err != nil {
+		return f, err
+	}
+	f.SinceYear = year
+
+	for _, idx := range queryList(r, "index") {
+		idx = strings.ToUpper(idx)
+		if len(idx) != 1 || idx[0] < 'A' || idx[0] > 'Z' {
+			return f, fmt.Errorf("index must be a single letter, got %q", idx)
+		}
+		f.Indexes = append(f.Indexes, idx)
+	}
+
+	return f, nil
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+//dev mail sink: writes each message to a file in dir, or to stdout when dir is empty.
+//never use it in production, since login links would end up in files and logs
+type SinkMailer struct {
+	Dir string
+}
+
+func (m SinkMailer) Send(to string, subject string, body string) error {
+	msg := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", to, subject, body)
+	if m.Dir == "" {
+		fmt.Print(msg)
+		return nil
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	//the address is hashed so it can never steer the path
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), HashToken(to)[:16])
+	return os.WriteFile(filepath.Join(m.Dir, name), []byte(msg), 0o600)
+}
+
+//sends through an smtp relay with plain auth when a user is set
+type SMTPMailer struct {
+	Host string
+	Port string
+	User string
+	Password string
+	From string
+}
+
+func (m SMTPMailer) Send(to string, subject string, body string) error {
+	var a smtp.Auth
+	if m.User != "" {
+		a = smtp.PlainAuth("", m.User, m.Password, m.Host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s\r\n", m.From, to, subject, body)
+	return smtp.SendMail(net.JoinHostPort(m.Host, m.Port), a, m.From, []string{to}, []byte(msg))
+}
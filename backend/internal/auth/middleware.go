@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const SessionCookie = "session"
+
+type ctxKey struct{}
+
+func UserFromContext(ctx context.Context) *User {
+	u, _ := ctx.Value(ctxKey{}).(*User)
+	return u
+}
+
+//bearer header first, then the session cookie
+func TokenFromRequest(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, "Bearer ") {
+		return strings.TrimPrefix(h, "Bearer ")
+	}
+	if c, err := r.Cookie(SessionCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+//attaches the session's user to the request context when there is a valid session. never rejects
+func (s *AuthService) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := TokenFromRequest(r); token != "" {
+			if u, err := s.userForSession(token); err == nil {
+				r = r.WithContext(context.WithValue(r.Context(), ctxKey{}, u))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+//csrf guard for the cookie session: a cross-site form can only send urlencoded, multipart or
+//text/plain bodies, so state-changing requests must either be bodyless or declare json
+func RequireJSONBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		ct := r.Header.Get("Content-Type")
+		if ct == "" && r.ContentLength == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if mediaType, _, err := mime.ParseMediaType(ct); err != nil || mediaType != "application/json" {
+			http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if UserFromContext(r.Context()) == nil {
+			http.Error(w, "login required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+//for routes with a {handle} param: the caller must be logged in and have bound the handle
+func (s *AuthService) RequireHandleOwner(next http.Handler) http.Handler {
+	return s.requireHandle(next, false)
+}
+
+//like RequireHandleOwner, but the binding must also have passed codeforces verification
+func (s *AuthService) RequireVerifiedHandle(next http.Handler) http.Handler {
+	return s.requireHandle(next, true)
+}
+
+func (s *AuthService) requireHandle(next http.Handler, mustBeVerified bool) http.Handler {
+	return RequireUser(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := UserFromContext(r.Context())
+		owns, verified, err := s.OwnsHandle(u.ID, chi.URLParam(r, "handle"))
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		if !owns {
+			http.Error(w, ErrHandleNotOwned.Error(), http.StatusForbidden)
+			return
+		}
+		if mustBeVerified && !verified {
+			http.Error(w, ErrHandleNotVerified.Error(), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
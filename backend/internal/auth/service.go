@@ -0,0 +1,254 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/mastery"
+)
+
+const (
+	sessionTTL = 30 * 24 * time.Hour
+	magicLinkTTL = 15 * time.Minute
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrEmailTaken = errors.New("email already registered")
+	ErrInvalidEmail = errors.New("invalid email address")
+	ErrInvalidToken = errors.New("invalid or expired token")
+	ErrHandleTaken = errors.New("handle is bound to another account")
+	ErrHandleNotOwned = errors.New("handle is not bound to this account")
+	ErrHandleNotVerified = errors.New("handle is not verified")
+	ErrMagicLinkDisabled = errors.New("magic-link login is not configured on this server")
+)
+
+type User struct {
+	ID int `json:"id"`
+	Email string `json:"email"`
+	Handles []HandleBinding `json:"handles"`
+}
+
+type HandleBinding struct {
+	Handle string `json:"handle"`
+	Verified bool `json:"verified"`
+}
+
+type AuthService struct {
+	conn *pgxpool.Pool
+	mailer Mailer //nil turns magic links off
+	cf mastery.CFClient //checks handle verification challenges
+	appURL string //where magic links point, e.g. the frontend's login page
+}
+
+func NewAuthService(conn *pgxpool.Pool, mailer Mailer, cf mastery.CFClient, appURL string) *AuthService {
+	return &AuthService{conn: conn, mailer: mailer, cf: cf, appURL: appURL}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+//a bare address like a@b.c; display names and anything net/mail would rewrite are rejected
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	return err == nil && addr.Address == email && addr.Name == ""
+}
+
+func (s *AuthService) Register(email string, password string) (string, error) {
+	email = normalizeEmail(email)
+	if !validEmail(email) {
+		return "", ErrInvalidEmail
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return "", err
+	}
+
+	var userID int
+	err = s.conn.QueryRow(context.Background(), `
+		INSERT INTO users (email, password_hash) VALUES ($1, $2)
+		RETURNING id
+	`, email, hash).Scan(&userID)
+	if isUniqueViolation(err) {
+		return "", ErrEmailTaken
+	}
+	if err != nil {
+		return "", err
+	}
+	return s.createSession(userID)
+}
+
+func (s *AuthService) Login(email string, password string) (string, error) {
+	var userID int
+	var hash *string
+	err := s.conn.QueryRow(context.Background(), `
+		SELECT id, password_hash FROM users WHERE email = $1
+	`, normalizeEmail(email)).Scan(&userID, &hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrInvalidCredentials
+	}
+	if err != nil {
+		return "", err
+	}
+	if hash == nil || !checkPassword(password, *hash) {
+		return "", ErrInvalidCredentials
+	}
+	return s.createSession(userID)
+}
+
+//emails a one-time login link, creating a passwordless account on first use
+func (s *AuthService) SendMagicLink(email string) error {
+	if s.mailer == nil {
+		return ErrMagicLinkDisabled
+	}
+	email = normalizeEmail(email)
+	if !validEmail(email) {
+		return ErrInvalidEmail
+	}
+
+	var userID int
+	err := s.conn.QueryRow(context.Background(), `
+		INSERT INTO users (email) VALUES ($1)
+		ON CONFLICT (email) DO UPDATE SET email = EXCLUDED.email
+		RETURNING id
+	`, email).Scan(&userID)
+	if err != nil {
+		return err
+	}
+
+	token, err := NewToken()
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.Exec(context.Background(), `
+		INSERT INTO login_tokens (token_hash, user_id, expires_at) VALUES ($1, $2, $3)
+	`, HashToken(token), userID, time.Now().Add(magicLinkTTL).UTC())
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(email, "Your Ascent login link",
+		"Sign in within 15 minutes: "+s.appURL+"?token="+token)
+}
+
+func (s *AuthService) VerifyMagicLink(token string) (string, error) {
+	var userID int
+	err := s.conn.QueryRow(context.Background(), `
+		DELETE FROM login_tokens
+		WHERE token_hash = $1 AND expires_at > NOW() AT TIME ZONE 'UTC'
+		RETURNING user_id
+	`, HashToken(token)).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrInvalidToken
+	}
+	if err != nil {
+		return "", err
+	}
+	return s.createSession(userID)
+}
+
+func (s *AuthService) Logout(token string) error {
+	_, err := s.conn.Exec(context.Background(), "DELETE FROM sessions WHERE token_hash = $1", HashToken(token))
+	return err
+}
+
+func (s *AuthService) createSession(userID int) (string, error) {
+	token, err := NewToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = s.conn.Exec(context.Background(), `
+		INSERT INTO sessions (token_hash, user_id, expires_at) VALUES ($1, $2, $3)
+	`, HashToken(token), userID, time.Now().Add(sessionTTL).UTC())
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *AuthService) userForSession(token string) (*User, error) {
+	var u User
+	err := s.conn.QueryRow(context.Background(), `
+		SELECT u.id, u.email
+		FROM sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.token_hash = $1 AND s.expires_at > NOW() AT TIME ZONE 'UTC'
+	`, HashToken(token)).Scan(&u.ID, &u.Email)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (s *AuthService) GetUser(userID int) (User, error) {
+	var u User
+	err := s.conn.QueryRow(context.Background(), "SELECT id, email FROM users WHERE id = $1", userID).Scan(&u.ID, &u.Email)
+	if err != nil {
+		return u, err
+	}
+	u.Handles, err = s.getHandles(userID)
+	return u, err
+}
+
+func (s *AuthService) getHandles(userID int) ([]HandleBinding, error) {
+	rows, err := s.conn.Query(context.Background(), `
+		SELECT handle, verified FROM user_handles WHERE user_id = $1 ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	handles := []HandleBinding{}
+	for rows.Next() {
+		var b HandleBinding
+		if err := rows.Scan(&b.Handle, &b.Verified); err != nil {
+			return nil, err
+		}
+		handles = append(handles, b)
+	}
+	return handles, rows.Err()
+}
+
+func (s *AuthService) UnbindHandle(userID int, handle string) error {
+	tag, err := s.conn.Exec(context.Background(), `
+		DELETE FROM user_handles WHERE LOWER(handle) = LOWER($1) AND user_id = $2
+	`, handle, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrHandleNotOwned
+	}
+	return nil
+}
+
+//reports whether the account has bound the handle and whether that binding is verified
+func (s *AuthService) OwnsHandle(userID int, handle string) (bool, bool, error) {
+	var verified bool
+	err := s.conn.QueryRow(context.Background(), `
+		SELECT verified FROM user_handles WHERE LOWER(handle) = LOWER($1) AND user_id = $2
+	`, handle, userID).Scan(&verified)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return true, verified, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
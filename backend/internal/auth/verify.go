@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const challengeTTL = 10 * time.Minute
+
+var (
+	ErrUnknownMethod = errors.New("method must be compile or name")
+	ErrAlreadyVerified = errors.New("handle is already verified")
+	ErrChallengeExpired = errors.New("challenge expired, start a new one")
+	ErrChallengeNotMet = errors.New("challenge not completed yet")
+	ErrChallengePending = errors.New("another account is verifying this handle, try again once its challenge expires")
+)
+
+//old, always-open problems where a compilation error costs nothing
+var challengeProblems = []string{"4A", "1A", "71A", "158A", "231A", "282A"}
+
+//what the user has to do on codeforces to prove they own the handle
+type Challenge struct {
+	Handle string `json:"handle"`
+	Method string `json:"method"`
+	Problem string `json:"problem,omitempty"`
+	Token string `json:"token,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Instructions string `json:"instructions"`
+}
+
+func newChallenge(handle string, method string) (Challenge, error) {
+	c := Challenge{Handle: handle, Method: method, ExpiresAt: time.Now().Add(challengeTTL).UTC()}
+	switch method {
+	case "compile":
+		c.Problem = challengeProblems[rand.IntN(len(challengeProblems))]
+		c.Instructions = fmt.Sprintf("Submit any code that fails to compile to problem %s within 10 minutes, then verify.", c.Problem)
+	case "name":
+		token, err := NewToken()
+		if err != nil {
+			return c, err
+		}
+		c.Token = "ascent-" + token[:12]
+		c.Instructions = fmt.Sprintf("Set your Codeforces first name to %s within 10 minutes, then verify.", c.Token)
+	default:
+		return c, ErrUnknownMethod
+	}
+	return c, nil
+}
+
+//claims a handle for the account and starts a verification challenge. a claim grants nothing
+//until it is verified; another account's claim is only taken over once its challenge has lapsed,
+//so a squatter can't keep resetting the real owner's challenge
+func (s *AuthService) BindHandle(userID int, handle string, method string) (Challenge, error) {
+	//also confirms the handle exists and gives us its canonical casing
+	info, err := s.cf.UserInfo(handle)
+	if err != nil {
+		return Challenge{}, err
+	}
+
+	c, err := newChallenge(info.Handle, method)
+	if err != nil {
+		return c, err
+	}
+
+	tag, err := s.conn.Exec(context.Background(), `
+		INSERT INTO user_handles (handle, user_id, challenge_method, challenge_token, challenge_problem, challenge_started_at, challenge_expires_at)
+		VALUES ($1, $2, $3, $4, $5, NOW() AT TIME ZONE 'UTC', $6)
+		ON CONFLICT ((LOWER(handle))) DO UPDATE
+		SET handle = EXCLUDED.handle,
+		    user_id = EXCLUDED.user_id,
+		    created_at = CASE WHEN user_handles.user_id = EXCLUDED.user_id THEN user_handles.created_at ELSE CURRENT_TIMESTAMP END,
+		    challenge_method = EXCLUDED.challenge_method,
+		    challenge_token = EXCLUDED.challenge_token,
+		    challenge_problem = EXCLUDED.challenge_problem,
+		    challenge_started_at = EXCLUDED.challenge_started_at,
+		    challenge_expires_at = EXCLUDED.challenge_expires_at
+		WHERE NOT user_handles.verified
+		AND (user_handles.user_id = EXCLUDED.user_id
+		     OR user_handles.challenge_expires_at IS NULL
+		     OR user_handles.challenge_expires_at < NOW() AT TIME ZONE 'UTC')
+	`, c.Handle, userID, c.Method, nullIfEmpty(c.Token), nullIfEmpty(c.Problem), c.ExpiresAt)
+	if err != nil {
+		return c, err
+	}
+	if tag.RowsAffected() == 0 {
+		var owner int
+		var verified bool
+		err := s.conn.QueryRow(context.Background(), `
+			SELECT user_id, verified FROM user_handles WHERE LOWER(handle) = LOWER($1)
+		`, c.Handle).Scan(&owner, &verified)
+		if err != nil {
+			return c, err
+		}
+		if owner == userID {
+			return c, ErrAlreadyVerified
+		}
+		if !verified {
+			return c, ErrChallengePending
+		}
+		return c, ErrHandleTaken
+	}
+	return c, nil
+}
+
+//checks codeforces for the pending challenge and marks the binding verified when it was met
+func (s *AuthService) VerifyHandle(userID int, handle string) error {
+	var canonical, method string
+	var token, problem *string
+	var verified bool
+	var startedAt, expiresAt *time.Time
+	err := s.conn.QueryRow(context.Background(), `
+		SELECT handle, verified, COALESCE(challenge_method, ''), challenge_token, challenge_problem,
+		       challenge_started_at, challenge_expires_at
+		FROM user_handles
+		WHERE LOWER(handle) = LOWER($1) AND user_id = $2
+	`, handle, userID).Scan(&canonical, &verified, &method, &token, &problem, &startedAt, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrHandleNotOwned
+	}
+	if err != nil {
+		return err
+	}
+	if verified {
+		return ErrAlreadyVerified
+	}
+	if startedAt == nil || expiresAt == nil {
+		return ErrChallengeExpired
+	}
+
+	var met bool
+	switch method {
+	case "compile":
+		met, err = s.compileErrorSubmitted(canonical, *problem, *startedAt, *expiresAt)
+	case "name":
+		met, err = s.firstNameMatches(canonical, *token)
+		//the name can only be checked now, so a late check can't count
+		if met && time.Now().UTC().After(*expiresAt) {
+			return ErrChallengeExpired
+		}
+	default:
+		return ErrChallengeExpired
+	}
+	if err != nil {
+		return err
+	}
+	if !met {
+		if time.Now().UTC().After(*expiresAt) {
+			return ErrChallengeExpired
+		}
+		return ErrChallengeNotMet
+	}
+
+	_, err = s.conn.Exec(context.Background(), `
+		UPDATE user_handles
+		SET verified = TRUE,
+		    challenge_method = NULL,
+		    challenge_token = NULL,
+		    challenge_problem = NULL,
+		    challenge_started_at = NULL,
+		    challenge_expires_at = NULL
+		WHERE LOWER(handle) = LOWER($1) AND user_id = $2
+	`, canonical, userID)
+	return err
+}
+
+//looks for a compilation error on the challenge problem sent while the challenge was open
+func (s *AuthService) compileErrorSubmitted(handle string, problem string, startedAt time.Time, expiresAt time.Time) (bool, error) {
+	subs, err := s.cf.UserStatus(handle)
+	if err != nil {
+		return false, err
+	}
+	for _, sub := range subs {
+		sent := time.Unix(sub.CreationTimeSeconds, 0).UTC()
+		//submissions come newest first
+		if sent.Before(startedAt) {
+			break
+		}
+		if sent.After(expiresAt) || sub.Verdict != "COMPILATION_ERROR" {
+			continue
+		}
+		if fmt.Sprintf("%d%s", sub.Problem.ContestID, sub.Problem.Index) == problem {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *AuthService) firstNameMatches(handle string, token string) (bool, error) {
+	info, err := s.cf.UserInfo(handle)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(info.FirstName) == token, nil
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -1,10 +1,34 @@
+CREATE TABLE IF NOT EXISTS contests (
+    contest_id INT PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    division TEXT NOT NULL DEFAULT 'other',
+    type TEXT NOT NULL DEFAULT '',
+    start_time TIMESTAMP
+);
+
 CREATE TABLE IF NOT EXISTS problems (
     problem_id TEXT PRIMARY KEY,
     name TEXT NOT NULL DEFAULT '',
     rating INT NOT NULL,
-    tags TEXT[]
+    tags TEXT[],
+    contest_id INT,
+    problem_index TEXT NOT NULL DEFAULT '',
+    estimated BOOLEAN NOT NULL DEFAULT FALSE,
+    lang TEXT NOT NULL DEFAULT 'en',
+    solved_count INT NOT NULL DEFAULT 0,
+    gym BOOLEAN NOT NULL DEFAULT FALSE
 );
 
+ALTER TABLE problems ADD COLUMN IF NOT EXISTS contest_id INT;
+ALTER TABLE problems ADD COLUMN IF NOT EXISTS problem_index TEXT NOT NULL DEFAULT '';
+ALTER TABLE problems ADD COLUMN IF NOT EXISTS estimated BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE problems ADD COLUMN IF NOT EXISTS lang TEXT NOT NULL DEFAULT 'en';
+ALTER TABLE problems ADD COLUMN IF NOT EXISTS solved_count INT NOT NULL DEFAULT 0;
+ALTER TABLE problems ADD COLUMN IF NOT EXISTS gym BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- gym contests are numbered from 100000; their rows exist for sync and are never recommended
+UPDATE problems SET gym = TRUE WHERE contest_id >= 100000 AND NOT gym;
+
 CREATE TABLE IF NOT EXISTS topics (
     id SERIAL PRIMARY KEY,
     slug TEXT UNIQUE NOT NULL,
@@ -33,7 +57,9 @@ CREATE TABLE IF NOT EXISTS user_interval_stats (
 
     bin_idx INT NOT NULL,
     bin_score FLOAT NOT NULL,
-    
+
+    -- legacy credit arrays from before user_solves. only read when a handle is first backfilled,
+    -- to recover manually logged solve times; drop once no handle still has them filled
     credits FLOAT[] NOT NULL DEFAULT '{}',
     multipliers FLOAT[] NOT NULL DEFAULT '{}',
 
@@ -42,14 +68,52 @@ CREATE TABLE IF NOT EXISTS user_interval_stats (
     PRIMARY KEY (handle, topic_slug, bin_idx)
 );
 
+ALTER TABLE user_interval_stats ADD COLUMN IF NOT EXISTS credits FLOAT[] NOT NULL DEFAULT '{}';
+ALTER TABLE user_interval_stats ADD COLUMN IF NOT EXISTS multipliers FLOAT[] NOT NULL DEFAULT '{}';
+
 CREATE TABLE IF NOT EXISTS user_problems(
     handle TEXT NOT NULL,
     problem_id TEXT NOT NULL,
     status TEXT NOT NULL,
     last_attempted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    attempts INT NOT NULL DEFAULT 0,
+    first_attempt_at TIMESTAMP,
+    solved_at TIMESTAMP,
+    verdicts JSONB NOT NULL DEFAULT '{}',
+    time_spent_minutes INT NOT NULL DEFAULT 0,
+    -- what the user entered on a manual submit, NULL when left blank. credit uses
+    -- time_spent_minutes, which only takes this value when nothing server-side timed the solve
+    reported_minutes INT,
     PRIMARY KEY (handle, problem_id)
 );
 
+ALTER TABLE user_problems ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+ALTER TABLE user_problems ADD COLUMN IF NOT EXISTS first_attempt_at TIMESTAMP;
+ALTER TABLE user_problems ADD COLUMN IF NOT EXISTS solved_at TIMESTAMP;
+ALTER TABLE user_problems ADD COLUMN IF NOT EXISTS verdicts JSONB NOT NULL DEFAULT '{}';
+ALTER TABLE user_problems ADD COLUMN IF NOT EXISTS time_spent_minutes INT NOT NULL DEFAULT 0;
+ALTER TABLE user_problems ADD COLUMN IF NOT EXISTS reported_minutes INT;
+
+CREATE TABLE IF NOT EXISTS user_solves (
+    handle TEXT NOT NULL,
+    problem_id TEXT NOT NULL,
+    rating INT NOT NULL,
+    estimated BOOLEAN NOT NULL DEFAULT FALSE,
+    attempts INT NOT NULL DEFAULT 1,
+    time_spent_minutes INT NOT NULL DEFAULT 0,
+    solved_at TIMESTAMP NOT NULL,
+    source TEXT NOT NULL DEFAULT 'sync' CHECK (source IN ('sync', 'manual', 'import')),
+    PRIMARY KEY (handle, problem_id)
+);
+
+ALTER TABLE user_solves ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'sync' CHECK (source IN ('sync', 'manual', 'import'));
+
+CREATE INDEX IF NOT EXISTS idx_user_solves_recent
+ON user_solves (handle, solved_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_user_solves_problem
+ON user_solves (problem_id);
+
 CREATE INDEX IF NOT EXISTS idx_user_problems_status
 ON user_problems(handle, status);
 
@@ -64,4 +128,157 @@ ON user_problems (handle, problem_id)
 WHERE status = 'solved';
 
 CREATE INDEX IF NOT EXISTS idx_user_problems_recent
-ON user_problems (handle, status, last_attempted_at DESC);
\ No newline at end of file
+ON user_problems (handle, status, last_attempted_at DESC);
+
+CREATE INDEX IF NOT EXISTS idx_problems_contest
+ON problems (contest_id);
+
+CREATE INDEX IF NOT EXISTS idx_contests_division
+ON contests (division, start_time);
+
+CREATE INDEX IF NOT EXISTS idx_problems_name_tsv
+ON problems USING GIN (to_tsvector('simple', name));
+
+CREATE TABLE IF NOT EXISTS problem_changes (
+    id BIGSERIAL PRIMARY KEY,
+    problem_id TEXT NOT NULL,
+    change_type TEXT NOT NULL,
+    old_rating INT,
+    new_rating INT,
+    old_tags TEXT[],
+    new_tags TEXT[],
+    changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_problem_changes_problem
+ON problem_changes (problem_id, changed_at DESC);
+
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    email TEXT UNIQUE NOT NULL,
+    password_hash TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    token_hash TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS login_tokens (
+    token_hash TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_handles (
+    handle TEXT NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- a binding only counts once the handle owner completes a codeforces challenge
+ALTER TABLE user_handles ADD COLUMN IF NOT EXISTS verified BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE user_handles ADD COLUMN IF NOT EXISTS challenge_method TEXT CHECK (challenge_method IN ('compile', 'name'));
+ALTER TABLE user_handles ADD COLUMN IF NOT EXISTS challenge_token TEXT;
+ALTER TABLE user_handles ADD COLUMN IF NOT EXISTS challenge_problem TEXT;
+ALTER TABLE user_handles ADD COLUMN IF NOT EXISTS challenge_started_at TIMESTAMP;
+ALTER TABLE user_handles ADD COLUMN IF NOT EXISTS challenge_expires_at TIMESTAMP;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_handles_handle
+ON user_handles (LOWER(handle));
+
+CREATE INDEX IF NOT EXISTS idx_user_handles_user
+ON user_handles (user_id);
+
+CREATE TABLE IF NOT EXISTS groups (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    owner_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- handle is the verified codeforces handle the member trains on; coaches may have none
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    handle TEXT,
+    role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'coach', 'member')),
+    joined_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_members_user
+ON group_members (user_id);
+
+CREATE TABLE IF NOT EXISTS group_invites (
+    token_hash TEXT PRIMARY KEY,
+    group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('coach', 'member')),
+    created_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS assignments (
+    id SERIAL PRIMARY KEY,
+    group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    created_by INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    title TEXT NOT NULL,
+    problem_ids TEXT[] NOT NULL,
+    due_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_assignments_group
+ON assignments (group_id, due_at);
+
+-- handles are copied from the group when the assignment is created, so later joiners aren't marked late
+CREATE TABLE IF NOT EXISTS assignment_targets (
+    assignment_id INTEGER NOT NULL REFERENCES assignments(id) ON DELETE CASCADE,
+    handle TEXT NOT NULL,
+    PRIMARY KEY (assignment_id, handle)
+);
+
+CREATE TABLE IF NOT EXISTS virtual_contests (
+    id SERIAL PRIMARY KEY,
+    handle TEXT NOT NULL,
+    topics TEXT[] NOT NULL,
+    start_at TIMESTAMP NOT NULL,
+    end_at TIMESTAMP NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'finished')),
+    solved INT NOT NULL DEFAULT 0,
+    penalty_minutes INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_virtual_contests_handle
+ON virtual_contests (handle, start_at DESC);
+
+-- solve results are filled in by sync from the user's codeforces submissions
+CREATE TABLE IF NOT EXISTS virtual_contest_problems (
+    contest_id INTEGER NOT NULL REFERENCES virtual_contests(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    problem_id TEXT NOT NULL,
+    solved_at TIMESTAMP,
+    wrong_attempts INT NOT NULL DEFAULT 0,
+    minutes INT,
+    PRIMARY KEY (contest_id, position)
+);
+
+-- a timer the user starts before working on a problem; sync closes it at the accepted submission
+CREATE TABLE IF NOT EXISTS solve_sessions (
+    id SERIAL PRIMARY KEY,
+    handle TEXT NOT NULL,
+    problem_id TEXT NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    paused_at TIMESTAMP,
+    paused_seconds INT NOT NULL DEFAULT 0,
+    status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'completed')),
+    completed_at TIMESTAMP,
+    minutes INT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_solve_sessions_active
+ON solve_sessions (handle, problem_id)
+WHERE status = 'active';
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
-	"unicode"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -16,6 +15,8 @@ import (
 
 func FillTables(conn *pgxpool.Pool) {
 	tagMap := mastery.GetTagMap()
+	fmt.Println("saving contests to db")
+	saveContestsToDB(conn)
 	fmt.Println("saving problems to db")
 	saveProblemsToDB(tagMap, conn)
 	fmt.Println("finished saving problems to db")
@@ -24,42 +25,13 @@ func FillTables(conn *pgxpool.Pool) {
 }
 
 func saveProblemsToDB(tagMap map[string]string, conn *pgxpool.Pool) {
-	problems, _ := getProblems()
+	problems, solvedCounts, _ := getProblems()
+	divisions := getContestDivisions(conn)
 
-	rows := make([][]any, 0, len(problems))
-
-	for _, p := range problems {
-		if p.Rating == 0 || cyrillic(p.Name) {
-			continue
-		}
-
-		topicSet := map[string]bool{}
-		hasDP, hasTrees := false, false
-		for _, tag := range p.Tags {
-			if topic, ok := tagMap[tag]; ok {
-				topicSet[topic] = true
-				if topic == "dynamic programming" {
-					hasDP = true
-				}
-				if topic == "trees" {
-					hasTrees = true
-				}
-			}
-		}
-		if hasDP && hasTrees {
-			topicSet["tree dp"] = true
-		}
-
-		filtered := make([]string, 0, len(topicSet))
-		for t := range topicSet {
-			filtered = append(filtered, t)
-		}
-		if len(filtered) == 0 {
-			continue
-		}
-
-		problemID := fmt.Sprintf("%d%s", p.ContestID, p.Index)
-		rows = append(rows, []any{problemID, p.Name, p.Rating, filtered})
+	catalog := mastery.BuildCatalogRows(problems, solvedCounts, divisions, tagMap)
+	rows := make([][]any, 0, len(catalog))
+	for _, p := range catalog {
+		rows = append(rows, []any{p.ID, p.Name, p.Rating, p.Tags, p.ContestID, p.Index, p.Estimated, p.Lang, p.SolvedCount})
 	}
 
 	tx, err := conn.Begin(context.Background())
@@ -73,7 +45,12 @@ func saveProblemsToDB(tagMap map[string]string, conn *pgxpool.Pool) {
 			problem_id TEXT PRIMARY KEY,
 			name TEXT NOT NULL DEFAULT '',
 			rating INT NOT NULL,
-			tags TEXT[]
+			tags TEXT[],
+			contest_id INT,
+			problem_index TEXT NOT NULL DEFAULT '',
+			estimated BOOLEAN NOT NULL DEFAULT FALSE,
+			lang TEXT NOT NULL DEFAULT 'en',
+			solved_count INT NOT NULL DEFAULT 0
 		) ON COMMIT DROP;
 	`)
 	if err != nil {
@@ -83,7 +60,7 @@ func saveProblemsToDB(tagMap map[string]string, conn *pgxpool.Pool) {
 	_, err = tx.CopyFrom(
 		context.Background(),
 		pgx.Identifier{"tmp_problems"},
-		[]string{"problem_id", "name", "rating", "tags"},
+		[]string{"problem_id", "name", "rating", "tags", "contest_id", "problem_index", "estimated", "lang", "solved_count"},
 		pgx.CopyFromRows(rows),
 	)
 	if err != nil {
@@ -91,13 +68,18 @@ func saveProblemsToDB(tagMap map[string]string, conn *pgxpool.Pool) {
 	}
 
 	_, err = tx.Exec(context.Background(), `
-		INSERT INTO problems (problem_id, name, rating, tags)
-		SELECT problem_id, name, rating, tags
+		INSERT INTO problems (problem_id, name, rating, tags, contest_id, problem_index, estimated, lang, solved_count)
+		SELECT problem_id, name, rating, tags, contest_id, problem_index, estimated, lang, solved_count
 		FROM tmp_problems
 		ON CONFLICT (problem_id) DO UPDATE
 		SET name = EXCLUDED.name,
 		    rating = EXCLUDED.rating,
-		    tags = EXCLUDED.tags;
+		    tags = EXCLUDED.tags,
+		    contest_id = EXCLUDED.contest_id,
+		    problem_index = EXCLUDED.problem_index,
+		    estimated = EXCLUDED.estimated,
+		    lang = EXCLUDED.lang,
+		    solved_count = EXCLUDED.solved_count;
 	`)
 	if err != nil {
 		panic(err)
@@ -108,6 +90,12 @@ func saveProblemsToDB(tagMap map[string]string, conn *pgxpool.Pool) {
 	}
 }
 
+func saveContestsToDB(conn *pgxpool.Pool) {
+	if _, err := mastery.RefreshContests(conn, mastery.NewCFClient()); err != nil {
+		fmt.Printf("could not save contests: %v\n", err)
+	}
+}
+
 func createTopics(tagMap map[string]string, conn *pgxpool.Pool) {
 	uniqueTopics := make(map[string]bool)
 	for _, topicSlug := range tagMap {
@@ -172,28 +160,43 @@ func createRoadMap(conn *pgxpool.Pool) {
 	linkTopics("graphs", "trees", conn)
 }
 
-func getProblems() ([]models.CFProblem, error) {
+//returns the problemset along with solve counts keyed by problem id
+func getProblems() ([]models.CFProblem, map[string]int, error) {
 	resp, err := http.Get("https://codeforces.com/api/problemset.problems")
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer resp.Body.Close()
 
 	var apiData models.CFResponse
 	if err := json.NewDecoder(resp.Body).Decode(&apiData); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return apiData.Result.Problems, nil
+	solvedCounts := make(map[string]int, len(apiData.Result.ProblemStatistics))
+	for _, st := range apiData.Result.ProblemStatistics {
+		solvedCounts[fmt.Sprintf("%d%s", st.ContestID, st.Index)] = st.SolvedCount
+	}
+
+	return apiData.Result.Problems, solvedCounts, nil
 }
 
-func cyrillic(s string) bool {
-	for _, r := range s {
-		if unicode.Is(unicode.Cyrillic, r) {
-			return true
+func getContestDivisions(conn *pgxpool.Pool) map[int]string {
+	divisions := make(map[int]string)
+	rows, err := conn.Query(context.Background(), "SELECT contest_id, division FROM contests")
+	if err != nil {
+		fmt.Printf("could not load contest divisions: %v\n", err)
+		return divisions
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var division string
+		if err := rows.Scan(&id, &division); err == nil {
+			divisions[id] = division
 		}
 	}
-	return false
+	return divisions
 }
 
 func getDisplayName(topic string) string {
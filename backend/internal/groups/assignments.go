@@ -0,0 +1,291 @@
+package groups
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrAssignmentNotFound = errors.New("assignment not found")
+	ErrNoProblems = errors.New("an assignment needs at least one problem")
+	ErrUnknownProblem = errors.New("unknown problem")
+	ErrNotGroupHandle = errors.New("every target handle must belong to a group member")
+)
+
+type Assignment struct {
+	ID int `json:"id"`
+	GroupID int `json:"group_id"`
+	CreatedBy int `json:"created_by"`
+	Title string `json:"title"`
+	Problems []string `json:"problems"`
+	Handles []string `json:"handles"`
+	DueAt time.Time `json:"due_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AssignmentInput struct {
+	Title string `json:"title"`
+	Problems []string `json:"problems"`
+	Handles []string `json:"handles"` //defaults to every member with a handle
+	DueAt time.Time `json:"due_at"`
+}
+
+type AssignmentProgress struct {
+	Handle string `json:"handle"`
+	Solved []string `json:"solved"`
+	Completed bool `json:"completed"`
+	CompletedAt *time.Time `json:"completed_at"`
+	Late bool `json:"late"` //finished after the due date, or still open past it
+	MasteryChange map[string]float64 `json:"mastery_change"` //assigned topics: now minus at assignment time
+}
+
+type AssignmentOverview struct {
+	Assignment
+	Topics []string `json:"topics"`
+	Completed int `json:"completed"`
+	Late int `json:"late"`
+	Members []AssignmentProgress `json:"members"`
+}
+
+//creates an assignment for some or all of the group's handles. only the owner and coaches can assign
+func (s *GroupService) CreateAssignment(userID int, groupID int, in AssignmentInput) (Assignment, error) {
+	if err := s.requireCoach(userID, groupID); err != nil {
+		return Assignment{}, err
+	}
+	problems := dedupe(in.Problems)
+	if len(problems) == 0 {
+		return Assignment{}, ErrNoProblems
+	}
+
+	found, _, err := s.mastery.GetProblemTopics(problems)
+	if err != nil {
+		return Assignment{}, err
+	}
+	if len(found) != len(problems) {
+		known := make(map[string]bool, len(found))
+		for _, id := range found {
+			known[id] = true
+		}
+		for _, id := range problems {
+			if !known[id] {
+				return Assignment{}, fmt.Errorf("%w: %s", ErrUnknownProblem, id)
+			}
+		}
+	}
+
+	members, err := s.memberHandles(groupID)
+	if err != nil {
+		return Assignment{}, err
+	}
+	handles := members
+	if len(in.Handles) > 0 {
+		byLower := make(map[string]string, len(members))
+		for _, h := range members {
+			byLower[strings.ToLower(h)] = h
+		}
+		handles = nil
+		for _, h := range dedupe(in.Handles) {
+			canonical, ok := byLower[strings.ToLower(h)]
+			if !ok {
+				return Assignment{}, fmt.Errorf("%w: %s", ErrNotGroupHandle, h)
+			}
+			handles = append(handles, canonical)
+		}
+	}
+
+	a := Assignment{GroupID: groupID, CreatedBy: userID, Title: in.Title, Problems: problems, Handles: handles, DueAt: in.DueAt.UTC()}
+	if a.Handles == nil {
+		a.Handles = []string{}
+	}
+
+	tx, err := s.conn.Begin(context.Background())
+	if err != nil {
+		return a, err
+	}
+	defer tx.Rollback(context.Background())
+
+	err = tx.QueryRow(context.Background(), `
+		INSERT INTO assignments (group_id, created_by, title, problem_ids, due_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, groupID, userID, a.Title, a.Problems, a.DueAt).Scan(&a.ID, &a.CreatedAt)
+	if err != nil {
+		return a, err
+	}
+
+	_, err = tx.Exec(context.Background(), `
+		INSERT INTO assignment_targets (assignment_id, handle)
+		SELECT $1, UNNEST($2::TEXT[])
+	`, a.ID, a.Handles)
+	if err != nil {
+		return a, err
+	}
+
+	return a, tx.Commit(context.Background())
+}
+
+//the group's assignments, soonest due first
+func (s *GroupService) ListAssignments(userID int, groupID int) ([]Assignment, error) {
+	if _, err := s.getGroupFor(userID, groupID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.conn.Query(context.Background(), `
+		SELECT a.id, a.group_id, a.created_by, a.title, a.problem_ids, a.due_at, a.created_at,
+		       COALESCE(ARRAY_AGG(t.handle ORDER BY t.handle) FILTER (WHERE t.handle IS NOT NULL), '{}')
+		FROM assignments a
+		LEFT JOIN assignment_targets t ON t.assignment_id = a.id
+		WHERE a.group_id = $1
+		GROUP BY a.id
+		ORDER BY a.due_at, a.id
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []Assignment{}
+	for rows.Next() {
+		var a Assignment
+		if err := rows.Scan(&a.ID, &a.GroupID, &a.CreatedBy, &a.Title, &a.Problems, &a.DueAt, &a.CreatedAt, &a.Handles); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, rows.Err()
+}
+
+//completion is read straight from user_problems, so a sync or manual submit is picked up immediately
+func (s *GroupService) GetAssignmentOverview(userID int, groupID int, assignmentID int) (AssignmentOverview, error) {
+	var ov AssignmentOverview
+	if _, err := s.getGroupFor(userID, groupID); err != nil {
+		return ov, err
+	}
+
+	a, err := s.getAssignment(groupID, assignmentID)
+	if err != nil {
+		return ov, err
+	}
+	ov.Assignment = a
+
+	_, topics, err := s.mastery.GetProblemTopics(a.Problems)
+	if err != nil {
+		return ov, err
+	}
+	ov.Topics = topics
+
+	solvedAt, err := s.loadSolveTimes(a.Handles, a.Problems)
+	if err != nil {
+		return ov, err
+	}
+	//both ends rebuilt with decay, since user_topic_stats is only as fresh as the last sync
+	now, err := s.mastery.GetMasteryAsOf(a.Handles, time.Now())
+	if err != nil {
+		return ov, err
+	}
+	then, err := s.mastery.GetMasteryAsOf(a.Handles, a.CreatedAt)
+	if err != nil {
+		return ov, err
+	}
+
+	ov.Members = []AssignmentProgress{}
+	for _, h := range a.Handles {
+		p := AssignmentProgress{Handle: h, Solved: []string{}, MasteryChange: make(map[string]float64, len(topics))}
+		var last time.Time
+		for _, id := range a.Problems {
+			if t, ok := solvedAt[strings.ToLower(h)][id]; ok {
+				p.Solved = append(p.Solved, id)
+				if t.After(last) {
+					last = t
+				}
+			}
+		}
+		if len(p.Solved) == len(a.Problems) {
+			p.Completed = true
+			p.CompletedAt = &last
+			p.Late = last.After(a.DueAt)
+		} else {
+			p.Late = time.Now().UTC().After(a.DueAt)
+		}
+		for _, topic := range topics {
+			p.MasteryChange[topic] = now[h][topic] - then[h][topic]
+		}
+
+		if p.Completed {
+			ov.Completed++
+		}
+		if p.Late {
+			ov.Late++
+		}
+		ov.Members = append(ov.Members, p)
+	}
+	return ov, nil
+}
+
+func (s *GroupService) getAssignment(groupID int, assignmentID int) (Assignment, error) {
+	var a Assignment
+	err := s.conn.QueryRow(context.Background(), `
+		SELECT a.id, a.group_id, a.created_by, a.title, a.problem_ids, a.due_at, a.created_at,
+		       COALESCE(ARRAY_AGG(t.handle ORDER BY t.handle) FILTER (WHERE t.handle IS NOT NULL), '{}')
+		FROM assignments a
+		LEFT JOIN assignment_targets t ON t.assignment_id = a.id
+		WHERE a.id = $1 AND a.group_id = $2
+		GROUP BY a.id
+	`, assignmentID, groupID).Scan(&a.ID, &a.GroupID, &a.CreatedBy, &a.Title, &a.Problems, &a.DueAt, &a.CreatedAt, &a.Handles)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return a, ErrAssignmentNotFound
+	}
+	return a, err
+}
+
+//lowercased handle -> problem id -> when it was solved
+func (s *GroupService) loadSolveTimes(handles []string, problems []string) (map[string]map[string]time.Time, error) {
+	out := make(map[string]map[string]time.Time, len(handles))
+	lowered := make([]string, len(handles))
+	for i, h := range handles {
+		lowered[i] = strings.ToLower(h)
+		out[lowered[i]] = make(map[string]time.Time)
+	}
+	if len(handles) == 0 {
+		return out, nil
+	}
+
+	//older rows predate solved_at, so fall back to the last attempt
+	rows, err := s.conn.Query(context.Background(), `
+		SELECT LOWER(handle), problem_id, COALESCE(solved_at, last_attempted_at)
+		FROM user_problems
+		WHERE LOWER(handle) = ANY($1) AND problem_id = ANY($2) AND status = 'solved'
+	`, lowered, problems)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var handle, id string
+		var t time.Time
+		if err := rows.Scan(&handle, &id, &t); err != nil {
+			return nil, err
+		}
+		out[handle][id] = t
+	}
+	return out, rows.Err()
+}
+
+func dedupe(items []string) []string {
+	var out []string
+	seen := make(map[string]bool, len(items))
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item != "" && !seen[item] {
+			out = append(out, item)
+			seen[item] = true
+		}
+	}
+	return out
+}
@@ -0,0 +1,269 @@
+package groups
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const leaderboardTTL = 5 * time.Minute
+
+var ErrInvalidMetric = errors.New("metric must be topic, overall or solves")
+var ErrTopicRequired = errors.New("metric=topic needs a topic")
+
+type LeaderboardEntry struct {
+	Rank int `json:"rank"`
+	Handle string `json:"handle"`
+	Value float64 `json:"value"`
+	Previous float64 `json:"previous"` //value at the start of the window, or over the window before it for solves
+	Delta float64 `json:"delta"`
+	PreviousRank int `json:"previous_rank"`
+	RankChange int `json:"rank_change"` //positive means moved up
+}
+
+type Leaderboard struct {
+	GroupID int `json:"group_id"`
+	Metric string `json:"metric"`
+	Topic string `json:"topic,omitempty"`
+	WindowDays int `json:"window_days"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Entries []LeaderboardEntry `json:"entries"`
+}
+
+type leaderboardKey struct {
+	groupID int
+	metric string
+	topic string
+	window int
+}
+
+type cachedLeaderboard struct {
+	board Leaderboard
+	expires time.Time
+}
+
+//leaderboards only change on sync, so a short ttl is enough to absorb dashboard polling
+type leaderboardCache struct {
+	mu sync.Mutex
+	entries map[leaderboardKey]cachedLeaderboard
+}
+
+func newLeaderboardCache() *leaderboardCache {
+	return &leaderboardCache{entries: make(map[leaderboardKey]cachedLeaderboard)}
+}
+
+func (c *leaderboardCache) get(key leaderboardKey) (Leaderboard, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		delete(c.entries, key)
+		return Leaderboard{}, false
+	}
+	return e.board, true
+}
+
+func (c *leaderboardCache) put(key leaderboardKey, board Leaderboard) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = cachedLeaderboard{board: board, expires: time.Now().Add(leaderboardTTL)}
+}
+
+//drops a group's boards when its membership changes
+func (c *leaderboardCache) invalidate(groupID int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if key.groupID == groupID {
+			delete(c.entries, key)
+		}
+	}
+}
+
+//ranks the group's handles by one metric:
+//topic - current mastery in the topic, delta against the mastery at the start of the window
+//overall - topic mastery weighted by each topic's share of the problemset, same delta
+//solves - problems solved in the last window days, delta against the window before
+func (s *GroupService) GetLeaderboard(userID int, groupID int, metric string, topic string, windowDays int) (Leaderboard, error) {
+	if metric != "topic" && metric != "overall" && metric != "solves" {
+		return Leaderboard{}, ErrInvalidMetric
+	}
+	if metric == "topic" && topic == "" {
+		return Leaderboard{}, ErrTopicRequired
+	}
+	if metric != "topic" {
+		topic = ""
+	}
+	if _, err := s.getGroupFor(userID, groupID); err != nil {
+		return Leaderboard{}, err
+	}
+
+	key := leaderboardKey{groupID: groupID, metric: metric, topic: topic, window: windowDays}
+	if board, ok := s.leaderboards.get(key); ok {
+		return board, nil
+	}
+
+	handles, err := s.memberHandles(groupID)
+	if err != nil {
+		return Leaderboard{}, err
+	}
+
+	var current, previous map[string]float64
+	switch metric {
+	case "solves":
+		current, previous, err = s.solveCounts(handles, windowDays)
+	default:
+		current, previous, err = s.masteryValues(handles, topic, windowDays)
+	}
+	if err != nil {
+		return Leaderboard{}, err
+	}
+
+	board := Leaderboard{
+		GroupID: groupID,
+		Metric: metric,
+		Topic: topic,
+		WindowDays: windowDays,
+		GeneratedAt: time.Now().UTC(),
+		Entries: rankEntries(handles, current, previous),
+	}
+	s.leaderboards.put(key, board)
+	return board, nil
+}
+
+//both ends are rebuilt from the bins with decay up to that moment. user_topic_stats is only as
+//fresh as the member's last sync, so comparing it against a decayed start would reward idling
+func (s *GroupService) masteryValues(handles []string, topic string, windowDays int) (map[string]float64, map[string]float64, error) {
+	at := time.Now()
+	now, err := s.mastery.GetMasteryAsOf(handles, at)
+	if err != nil {
+		return nil, nil, err
+	}
+	then, err := s.mastery.GetMasteryAsOf(handles, at.AddDate(0, 0, -windowDays))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if topic != "" {
+		current := make(map[string]float64, len(handles))
+		previous := make(map[string]float64, len(handles))
+		for _, h := range handles {
+			current[h] = now[h][topic]
+			previous[h] = then[h][topic]
+		}
+		return current, previous, nil
+	}
+
+	weights, err := s.mastery.GetTopicWeights()
+	if err != nil {
+		return nil, nil, err
+	}
+	return weightedMastery(handles, now, weights), weightedMastery(handles, then, weights), nil
+}
+
+func weightedMastery(handles []string, mastery map[string]map[string]float64, weights map[string]float64) map[string]float64 {
+	var weightSum float64
+	for _, w := range weights {
+		weightSum += w
+	}
+
+	out := make(map[string]float64, len(handles))
+	for _, h := range handles {
+		var total float64
+		for topic, w := range weights {
+			total += w * mastery[h][topic]
+		}
+		if weightSum > 0 {
+			out[h] = total / weightSum
+		}
+	}
+	return out
+}
+
+func (s *GroupService) solveCounts(handles []string, windowDays int) (map[string]float64, map[string]float64, error) {
+	current := make(map[string]float64, len(handles))
+	previous := make(map[string]float64, len(handles))
+	byLower := make(map[string]string, len(handles))
+	lowered := make([]string, len(handles))
+	for i, h := range handles {
+		byLower[strings.ToLower(h)] = h
+		lowered[i] = strings.ToLower(h)
+	}
+	if len(handles) == 0 {
+		return current, previous, nil
+	}
+
+	now := time.Now().UTC()
+	start := now.AddDate(0, 0, -windowDays)
+	prevStart := start.AddDate(0, 0, -windowDays)
+	//user_solves always has a solve time, unlike user_problems rows synced before it was stored
+	rows, err := s.conn.Query(context.Background(), `
+		SELECT LOWER(handle),
+		       COUNT(*) FILTER (WHERE solved_at >= $2),
+		       COUNT(*) FILTER (WHERE solved_at < $2)
+		FROM user_solves
+		WHERE LOWER(handle) = ANY($1) AND solved_at >= $3 AND solved_at < $4
+		GROUP BY LOWER(handle)
+	`, lowered, start, prevStart, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var handle string
+		var cur, prev int
+		if err := rows.Scan(&handle, &cur, &prev); err != nil {
+			return nil, nil, err
+		}
+		current[byLower[handle]] = float64(cur)
+		previous[byLower[handle]] = float64(prev)
+	}
+	return current, previous, rows.Err()
+}
+
+//ranks by value, ties sharing a rank and broken by handle for a stable order
+func rankEntries(handles []string, current map[string]float64, previous map[string]float64) []LeaderboardEntry {
+	prevRanks := ranks(handles, previous)
+	curRanks := ranks(handles, current)
+
+	entries := make([]LeaderboardEntry, 0, len(handles))
+	for _, h := range handles {
+		entries = append(entries, LeaderboardEntry{
+			Rank: curRanks[h],
+			Handle: h,
+			Value: current[h],
+			Previous: previous[h],
+			Delta: current[h] - previous[h],
+			PreviousRank: prevRanks[h],
+			RankChange: prevRanks[h] - curRanks[h],
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Rank != entries[j].Rank {
+			return entries[i].Rank < entries[j].Rank
+		}
+		return entries[i].Handle < entries[j].Handle
+	})
+	return entries
+}
+
+func ranks(handles []string, values map[string]float64) map[string]int {
+	sorted := append([]string(nil), handles...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return values[sorted[i]] > values[sorted[j]]
+	})
+
+	out := make(map[string]int, len(sorted))
+	for i, h := range sorted {
+		if i > 0 && values[h] == values[sorted[i-1]] {
+			out[h] = out[sorted[i-1]]
+		} else {
+			out[h] = i + 1
+		}
+	}
+	return out
+}
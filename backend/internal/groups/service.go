@@ -0,0 +1,304 @@
+package groups
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/auth"
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/mastery"
+)
+
+const inviteTTL = 7 * 24 * time.Hour
+
+var (
+	ErrGroupNotFound = errors.New("group not found")
+	ErrNotMember = errors.New("not a member of this group")
+	ErrNotCoach = errors.New("only the owner or a coach can do this")
+	ErrInvalidInvite = errors.New("invalid or expired invite")
+	ErrInvalidRole = errors.New("role must be coach or member")
+	ErrHandleNotVerified = errors.New("handle is not a verified handle of this account")
+	ErrNoMemberHandles = errors.New("no group member has a handle yet")
+	ErrInvalidTarget = errors.New("target must be min, mean or max")
+)
+
+type Group struct {
+	ID int `json:"id"`
+	Name string `json:"name"`
+	OwnerID int `json:"owner_id"`
+	Role string `json:"role"` //the caller's role
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Member struct {
+	UserID int `json:"user_id"`
+	Handle *string `json:"handle"`
+	Role string `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type GroupDetail struct {
+	Group
+	Members []Member `json:"members"`
+}
+
+type Invite struct {
+	Token string `json:"token"`
+	Role string `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type GroupService struct {
+	conn *pgxpool.Pool
+	mastery *mastery.MasteryService
+	leaderboards *leaderboardCache
+}
+
+func NewGroupService(conn *pgxpool.Pool, ms *mastery.MasteryService) *GroupService {
+	return &GroupService{conn: conn, mastery: ms, leaderboards: newLeaderboardCache()}
+}
+
+//creates a group owned by the caller. handle is optional and must be one of their verified handles
+func (s *GroupService) CreateGroup(userID int, name string, handle string) (Group, error) {
+	if err := s.checkHandle(userID, handle); err != nil {
+		return Group{}, err
+	}
+
+	tx, err := s.conn.Begin(context.Background())
+	if err != nil {
+		return Group{}, err
+	}
+	defer tx.Rollback(context.Background())
+
+	g := Group{Name: name, OwnerID: userID, Role: "owner"}
+	err = tx.QueryRow(context.Background(), `
+		INSERT INTO groups (name, owner_id) VALUES ($1, $2)
+		RETURNING id, created_at
+	`, name, userID).Scan(&g.ID, &g.CreatedAt)
+	if err != nil {
+		return g, err
+	}
+
+	_, err = tx.Exec(context.Background(), `
+		INSERT INTO group_members (group_id, user_id, handle, role) VALUES ($1, $2, $3, 'owner')
+	`, g.ID, userID, nullIfEmpty(handle))
+	if err != nil {
+		return g, err
+	}
+
+	return g, tx.Commit(context.Background())
+}
+
+func (s *GroupService) ListGroups(userID int) ([]Group, error) {
+	rows, err := s.conn.Query(context.Background(), `
+		SELECT g.id, g.name, g.owner_id, m.role, g.created_at
+		FROM group_members m
+		JOIN groups g ON g.id = m.group_id
+		WHERE m.user_id = $1
+		ORDER BY g.created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := []Group{}
+	for rows.Next() {
+		var g Group
+		if err := rows.Scan(&g.ID, &g.Name, &g.OwnerID, &g.Role, &g.CreatedAt); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+func (s *GroupService) GetGroup(userID int, groupID int) (GroupDetail, error) {
+	var d GroupDetail
+	g, err := s.getGroupFor(userID, groupID)
+	if err != nil {
+		return d, err
+	}
+	d.Group = g
+
+	rows, err := s.conn.Query(context.Background(), `
+		SELECT user_id, handle, role, joined_at
+		FROM group_members
+		WHERE group_id = $1
+		ORDER BY joined_at
+	`, groupID)
+	if err != nil {
+		return d, err
+	}
+	defer rows.Close()
+
+	d.Members = []Member{}
+	for rows.Next() {
+		var m Member
+		if err := rows.Scan(&m.UserID, &m.Handle, &m.Role, &m.JoinedAt); err != nil {
+			return d, err
+		}
+		d.Members = append(d.Members, m)
+	}
+	return d, rows.Err()
+}
+
+//issues a reusable invite token. only the owner and coaches can invite
+func (s *GroupService) CreateInvite(userID int, groupID int, role string) (Invite, error) {
+	if role == "" {
+		role = "member"
+	}
+	if role != "member" && role != "coach" {
+		return Invite{}, ErrInvalidRole
+	}
+	if err := s.requireCoach(userID, groupID); err != nil {
+		return Invite{}, err
+	}
+
+	token, err := auth.NewToken()
+	if err != nil {
+		return Invite{}, err
+	}
+	inv := Invite{Token: token, Role: role, ExpiresAt: time.Now().Add(inviteTTL).UTC()}
+	_, err = s.conn.Exec(context.Background(), `
+		INSERT INTO group_invites (token_hash, group_id, role, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, auth.HashToken(token), groupID, role, userID, inv.ExpiresAt)
+	return inv, err
+}
+
+//joins the group an invite points to. joining again just updates the member's handle
+func (s *GroupService) Join(userID int, token string, handle string) (Group, error) {
+	if err := s.checkHandle(userID, handle); err != nil {
+		return Group{}, err
+	}
+
+	var groupID int
+	var role string
+	err := s.conn.QueryRow(context.Background(), `
+		SELECT group_id, role FROM group_invites
+		WHERE token_hash = $1 AND expires_at > NOW() AT TIME ZONE 'UTC'
+	`, auth.HashToken(token)).Scan(&groupID, &role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Group{}, ErrInvalidInvite
+	}
+	if err != nil {
+		return Group{}, err
+	}
+
+	//an existing member keeps their role, so an invite can't demote the owner
+	_, err = s.conn.Exec(context.Background(), `
+		INSERT INTO group_members (group_id, user_id, handle, role) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (group_id, user_id) DO UPDATE
+		SET handle = COALESCE(EXCLUDED.handle, group_members.handle)
+	`, groupID, userID, nullIfEmpty(handle), role)
+	if err != nil {
+		return Group{}, err
+	}
+	s.leaderboards.invalidate(groupID)
+	return s.getGroupFor(userID, groupID)
+}
+
+func (s *GroupService) getGroupFor(userID int, groupID int) (Group, error) {
+	var g Group
+	var role *string
+	err := s.conn.QueryRow(context.Background(), `
+		SELECT g.id, g.name, g.owner_id, m.role, g.created_at
+		FROM groups g
+		LEFT JOIN group_members m ON m.group_id = g.id AND m.user_id = $2
+		WHERE g.id = $1
+	`, groupID, userID).Scan(&g.ID, &g.Name, &g.OwnerID, &role, &g.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return g, ErrGroupNotFound
+	}
+	if err != nil {
+		return g, err
+	}
+	if role == nil {
+		return g, ErrNotMember
+	}
+	g.Role = *role
+	return g, nil
+}
+
+func (s *GroupService) requireCoach(userID int, groupID int) error {
+	g, err := s.getGroupFor(userID, groupID)
+	if err != nil {
+		return err
+	}
+	if g.Role != "owner" && g.Role != "coach" {
+		return ErrNotCoach
+	}
+	return nil
+}
+
+//an empty handle is allowed (coaches who don't compete); otherwise it must be verified for the user
+func (s *GroupService) checkHandle(userID int, handle string) error {
+	if handle == "" {
+		return nil
+	}
+	var ok bool
+	err := s.conn.QueryRow(context.Background(), `
+		SELECT EXISTS (SELECT 1 FROM user_handles WHERE LOWER(handle) = LOWER($1) AND user_id = $2 AND verified)
+	`, handle, userID).Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrHandleNotVerified
+	}
+	return nil
+}
+
+//recommends problems for the whole group at once: the target comes from the members' combined
+//mastery and nothing any member has solved or attempted is returned
+func (s *GroupService) RecommendForGroup(userID int, groupID int, topics []string, opts mastery.RecommendOptions) ([]mastery.CFProblemOutput, error) {
+	if opts.GroupTarget != "min" && opts.GroupTarget != "mean" && opts.GroupTarget != "max" {
+		return nil, ErrInvalidTarget
+	}
+	if _, err := s.getGroupFor(userID, groupID); err != nil {
+		return nil, err
+	}
+	handles, err := s.memberHandles(groupID)
+	if err != nil {
+		return nil, err
+	}
+	if len(handles) == 0 {
+		return nil, ErrNoMemberHandles
+	}
+
+	opts.Group = handles
+	return s.mastery.RecommendProblem("", topics, opts)
+}
+
+//handles of the members who train on one, in join order
+func (s *GroupService) memberHandles(groupID int) ([]string, error) {
+	rows, err := s.conn.Query(context.Background(), `
+		SELECT handle FROM group_members
+		WHERE group_id = $1 AND handle IS NOT NULL
+		ORDER BY joined_at
+	`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var handles []string
+	for rows.Next() {
+		var h string
+		if err := rows.Scan(&h); err != nil {
+			return nil, err
+		}
+		handles = append(handles, h)
+	}
+	return handles, rows.Err()
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,181 @@
+package groups
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//a member covers a topic when their mastery is at least this fraction of the team's typical best topic
+const coverageRatio = 0.8
+
+type TopicAggregate struct {
+	Topic string `json:"topic"`
+	Mean float64 `json:"mean"`
+	Median float64 `json:"median"`
+	Max float64 `json:"max"`
+	Best string `json:"best"` //handle holding the max
+	CoveredBy []string `json:"covered_by"`
+}
+
+type MemberSummary struct {
+	Handle string `json:"handle"`
+	Overall float64 `json:"overall"` //mean mastery across topics
+	Strongest string `json:"strongest"`
+	Weakest string `json:"weakest"`
+}
+
+type GroupStats struct {
+	GroupID int `json:"group_id"`
+	Members []MemberSummary `json:"members"`
+	Topics []TopicAggregate `json:"topics"`
+	CoverageBar float64 `json:"coverage_bar"`
+	Gaps []string `json:"gaps"` //topics nobody on the team covers
+}
+
+//aggregates user_topic_stats over the group's handles. members with no row for a topic count as 0
+func (s *GroupService) GetGroupStats(userID int, groupID int) (GroupStats, error) {
+	stats := GroupStats{GroupID: groupID, Members: []MemberSummary{}, Topics: []TopicAggregate{}, Gaps: []string{}}
+	if _, err := s.getGroupFor(userID, groupID); err != nil {
+		return stats, err
+	}
+
+	handles, err := s.memberHandles(groupID)
+	if err != nil {
+		return stats, err
+	}
+	topics, err := loadTopics(s.conn)
+	if err != nil {
+		return stats, err
+	}
+	mastery, err := loadMastery(s.conn, handles)
+	if err != nil {
+		return stats, err
+	}
+	if len(handles) == 0 {
+		return stats, nil
+	}
+
+	for _, topic := range topics {
+		agg := TopicAggregate{Topic: topic, CoveredBy: []string{}}
+		scores := make([]float64, len(handles))
+		for i, h := range handles {
+			scores[i] = mastery[h][topic]
+			agg.Mean += scores[i]
+			if scores[i] > agg.Max || agg.Best == "" {
+				agg.Max = scores[i]
+				agg.Best = h
+			}
+		}
+		agg.Mean /= float64(len(handles))
+		agg.Median = median(scores)
+		stats.Topics = append(stats.Topics, agg)
+	}
+
+	maxes := make([]float64, len(stats.Topics))
+	for i, agg := range stats.Topics {
+		maxes[i] = agg.Max
+	}
+	stats.CoverageBar = coverageRatio * median(maxes)
+
+	for i := range stats.Topics {
+		agg := &stats.Topics[i]
+		for _, h := range handles {
+			if stats.CoverageBar > 0 && mastery[h][agg.Topic] >= stats.CoverageBar {
+				agg.CoveredBy = append(agg.CoveredBy, h)
+			}
+		}
+		if len(agg.CoveredBy) == 0 {
+			stats.Gaps = append(stats.Gaps, agg.Topic)
+		}
+	}
+
+	for _, h := range handles {
+		m := MemberSummary{Handle: h}
+		for i, topic := range topics {
+			score := mastery[h][topic]
+			m.Overall += score
+			if i == 0 || score > mastery[h][m.Strongest] {
+				m.Strongest = topic
+			}
+			if i == 0 || score < mastery[h][m.Weakest] {
+				m.Weakest = topic
+			}
+		}
+		if len(topics) > 0 {
+			m.Overall /= float64(len(topics))
+		}
+		stats.Members = append(stats.Members, m)
+	}
+
+	return stats, nil
+}
+
+func loadTopics(conn *pgxpool.Pool) ([]string, error) {
+	rows, err := conn.Query(context.Background(), "SELECT slug FROM topics ORDER BY slug")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var topics []string
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return nil, err
+		}
+		topics = append(topics, slug)
+	}
+	return topics, rows.Err()
+}
+
+//handle -> topic -> current mastery. handles are matched case-insensitively and keyed as given
+func loadMastery(conn *pgxpool.Pool, handles []string) (map[string]map[string]float64, error) {
+	out := make(map[string]map[string]float64, len(handles))
+	byLower := make(map[string]string, len(handles))
+	lowered := make([]string, len(handles))
+	for i, h := range handles {
+		out[h] = make(map[string]float64)
+		byLower[strings.ToLower(h)] = h
+		lowered[i] = strings.ToLower(h)
+	}
+	if len(handles) == 0 {
+		return out, nil
+	}
+
+	rows, err := conn.Query(context.Background(), `
+		SELECT LOWER(handle), topic_slug, mastery_score
+		FROM user_topic_stats
+		WHERE LOWER(handle) = ANY($1)
+	`, lowered)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var handle, topic string
+		var score float64
+		if err := rows.Scan(&handle, &topic, &score); err != nil {
+			return nil, err
+		}
+		out[byLower[handle]][topic] = score
+	}
+	return out, rows.Err()
+}
+
+func median(xs []float64) float64 {
+	if len(xs) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(xs)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
@@ -0,0 +1,194 @@
+package mastery
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//sort key expression and direction for each catalog ordering. ties break on problem_id ascending
+var catalogSorts = map[string]struct {
+	expr string
+	desc bool
+}{
+	"newest": {"COALESCE(p.contest_id, 0)", true},
+	"oldest": {"COALESCE(p.contest_id, 0)", false},
+	"rating": {"p.rating", false},
+	"-rating": {"p.rating", true},
+	"popular": {"p.solved_count", true},
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+func IsCatalogSort(sort string) bool {
+	_, ok := catalogSorts[sort]
+	return ok
+}
+
+//searches the problem table. returns one page plus the cursor for the next page ("" when done)
+func searchProblems(conn *pgxpool.Pool, q CatalogQuery) ([]CatalogProblem, string, error) {
+	sortKey, ok := catalogSorts[q.Sort]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown sort %q", q.Sort)
+	}
+
+	var conds []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if q.Text != "" {
+		conds = append(conds, "to_tsvector('simple', p.name) @@ websearch_to_tsquery('simple', "+arg(q.Text)+")")
+	}
+	if len(q.Tags) > 0 {
+		conds = append(conds, "p.tags @> "+arg(q.Tags)+"::text[]")
+	}
+	if q.MinRating > 0 {
+		conds = append(conds, "p.rating >= "+arg(q.MinRating))
+	}
+	if q.MaxRating > 0 {
+		conds = append(conds, "p.rating <= "+arg(q.MaxRating))
+	}
+	if q.SolvedBy != "" {
+		conds = append(conds, `EXISTS (
+			SELECT 1 FROM user_problems up
+			WHERE up.handle = `+arg(q.SolvedBy)+` AND up.problem_id = p.problem_id AND up.status = 'solved'
+		)`)
+	}
+	if q.UnsolvedBy != "" {
+		conds = append(conds, `NOT EXISTS (
+			SELECT 1 FROM user_problems up
+			WHERE up.handle = `+arg(q.UnsolvedBy)+` AND up.problem_id = p.problem_id AND up.status = 'solved'
+		)`)
+	}
+
+	if q.Cursor != "" {
+		key, id, err := decodeCatalogCursor(q.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		op := ">"
+		if sortKey.desc {
+			op = "<"
+		}
+		k, i := arg(key), arg(id)
+		conds = append(conds, fmt.Sprintf("(%s %s %s OR (%s = %s AND p.problem_id > %s))", sortKey.expr, op, k, sortKey.expr, k, i))
+	}
+
+	where := "TRUE"
+	if len(conds) > 0 {
+		where = strings.Join(conds, " AND ")
+	}
+
+	filterCond, filterArgs := getProblemFilterSQL(q.Filter, len(args)+1)
+	args = append(args, filterArgs...)
+
+	dir := "ASC"
+	if sortKey.desc {
+		dir = "DESC"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT p.problem_id, p.name, p.rating, p.tags, COALESCE(p.contest_id, 0), p.problem_index,
+		       p.estimated, p.solved_count, COALESCE(up.status, ''), %s
+		FROM problems p
+		LEFT JOIN user_problems up ON up.problem_id = p.problem_id AND up.handle = %s
+		WHERE %s
+		%s
+		ORDER BY %s %s, p.problem_id ASC
+		LIMIT %s
+	`, sortKey.expr, arg(q.Handle), where, filterCond, sortKey.expr, dir, arg(q.Limit+1))
+
+	rows, err := conn.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	problems := make([]CatalogProblem, 0, q.Limit)
+	var keys []int
+	for rows.Next() {
+		var p CatalogProblem
+		var key int
+		if err := rows.Scan(&p.ID, &p.Name, &p.Rating, &p.Tags, &p.ContestID, &p.Index, &p.Estimated, &p.SolvedCount, &p.Status, &key); err != nil {
+			return nil, "", err
+		}
+		problems = append(problems, p)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(problems) > q.Limit {
+		problems = problems[:q.Limit]
+		last := q.Limit - 1
+		next = encodeCatalogCursor(keys[last], problems[last].ID)
+	}
+	return problems, next, nil
+}
+
+func encodeCatalogCursor(key int, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(key) + "|" + id))
+}
+
+func decodeCatalogCursor(cursor string) (int, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	keyStr, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return 0, "", ErrInvalidCursor
+	}
+	key, err := strconv.Atoi(keyStr)
+	if err != nil {
+		return 0, "", ErrInvalidCursor
+	}
+	return key, id, nil
+}
+
+//looks up catalog problems by id, returning the ids that exist and the union of their topic slugs.
+//the catalog's tags column already holds slugs
+func getProblemTopics(conn *pgxpool.Pool, ids []string) ([]string, []string, error) {
+	rows, err := conn.Query(context.Background(), `
+		SELECT problem_id, COALESCE(tags, '{}') FROM problems WHERE problem_id = ANY($1)
+	`, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var found []string
+	seen := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		var tags []string
+		if err := rows.Scan(&id, &tags); err != nil {
+			return nil, nil, err
+		}
+		found = append(found, id)
+		for _, topic := range tags {
+			seen[topic] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	topics := make([]string, 0, len(seen))
+	for topic := range seen {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return found, topics, nil
+}
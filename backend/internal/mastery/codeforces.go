@@ -0,0 +1,129 @@
+package mastery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/models"
+)
+
+var ErrHandleNotFound = errors.New("codeforces handle not found")
+
+//everything the engine needs from the codeforces api. swap in a stub for offline use
+type CFClient interface {
+	UserStatus(handle string) ([]CFSubmission, error)
+	UserRating(handle string) ([]CFRatingChange, error)
+	UserInfo(handle string) (CFUser, error)
+	ContestStandings(contestID int, handle string) (CFStandings, error)
+	ProblemsetProblems() ([]models.CFProblem, []models.CFProblemStatistics, error)
+	ContestList() ([]CFContest, error)
+}
+
+type httpCFClient struct {
+	baseURL string
+	client *http.Client
+	minInterval time.Duration
+
+	mu sync.Mutex
+	lastCall time.Time
+}
+
+func NewCFClient() CFClient {
+	return &httpCFClient{
+		baseURL: "https://codeforces.com/api/",
+		client: &http.Client{Timeout: 30 * time.Second},
+		minInterval: 2 * time.Second,
+	}
+}
+
+//codeforces allows roughly one call every two seconds, so calls are spaced out
+func (c *httpCFClient) wait() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d := c.minInterval - time.Since(c.lastCall); d > 0 {
+		time.Sleep(d)
+	}
+	c.lastCall = time.Now()
+}
+
+func (c *httpCFClient) get(method string, params url.Values, out any) error {
+	c.wait()
+
+	resp, err := c.client.Get(c.baseURL + method + "?" + params.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		Status string `json:"status"`
+		Comment string `json:"comment"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return err
+	}
+	if envelope.Status != "OK" {
+		//e.g. "handle: User with handle x not found"; anything else (rate limits, outages) is passed through
+		if strings.HasPrefix(envelope.Comment, "handle") && strings.Contains(envelope.Comment, "not found") {
+			return fmt.Errorf("%s failed: %s: %w", method, envelope.Comment, ErrHandleNotFound)
+		}
+		return fmt.Errorf("%s failed: %s", method, envelope.Comment)
+	}
+	return json.Unmarshal(envelope.Result, out)
+}
+
+func (c *httpCFClient) UserStatus(handle string) ([]CFSubmission, error) {
+	var subs []CFSubmission
+	err := c.get("user.status", url.Values{"handle": {handle}}, &subs)
+	return subs, err
+}
+
+func (c *httpCFClient) UserRating(handle string) ([]CFRatingChange, error) {
+	var changes []CFRatingChange
+	err := c.get("user.rating", url.Values{"handle": {handle}}, &changes)
+	return changes, err
+}
+
+func (c *httpCFClient) UserInfo(handle string) (CFUser, error) {
+	var users []CFUser
+	if err := c.get("user.info", url.Values{"handles": {handle}}, &users); err != nil {
+		return CFUser{}, err
+	}
+	if len(users) == 0 {
+		return CFUser{}, fmt.Errorf("user.info returned no user for %s", handle)
+	}
+	return users[0], nil
+}
+
+func (c *httpCFClient) ContestStandings(contestID int, handle string) (CFStandings, error) {
+	var standings CFStandings
+	err := c.get("contest.standings", url.Values{
+		"contestId": {strconv.Itoa(contestID)},
+		"handles": {handle},
+		"showUnofficial": {"false"},
+	}, &standings)
+	return standings, err
+}
+
+func (c *httpCFClient) ProblemsetProblems() ([]models.CFProblem, []models.CFProblemStatistics, error) {
+	var result struct {
+		Problems []models.CFProblem `json:"problems"`
+		ProblemStatistics []models.CFProblemStatistics `json:"problemStatistics"`
+	}
+	err := c.get("problemset.problems", url.Values{}, &result)
+	return result.Problems, result.ProblemStatistics, err
+}
+
+func (c *httpCFClient) ContestList() ([]CFContest, error) {
+	var contests []CFContest
+	err := c.get("contest.list", url.Values{}, &contests)
+	return contests, err
+}
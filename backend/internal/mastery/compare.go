@@ -0,0 +1,106 @@
+package mastery
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//how many of the widest topic gaps a comparison calls out
+const compareTopGaps = 5
+
+//lines up several handles' mastery per topic, the gap between the best and worst of them, and
+//for each handle the problems only they have solved. limit caps that list per handle, newest first
+func compareHandles(conn *pgxpool.Pool, handles []string, limit int, tagMap map[string]string) (Comparison, error) {
+	cmp := Comparison{Handles: handles, Topics: []TopicComparison{}, LargestGaps: []TopicComparison{}, Exclusive: make(map[string][]CFProblemOutput)}
+
+	stats := make(map[string]map[string]MasteryResult, len(handles))
+	for _, h := range handles {
+		s, err := getAllStats(conn, h)
+		if err != nil {
+			return cmp, err
+		}
+		stats[h] = s
+	}
+
+	topics := make([]string, 0)
+	for topic := range getTopics(tagMap) {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	for _, topic := range topics {
+		tc := TopicComparison{Topic: topic, Mastery: make(map[string]MasteryResult, len(handles))}
+		first := true
+		var lo float64
+		for _, h := range handles {
+			m := stats[h][topic]
+			tc.Mastery[h] = m
+			if first || m.Current > tc.Mastery[tc.Leader].Current {
+				tc.Leader = h
+			}
+			if first || m.Current < lo {
+				lo = m.Current
+			}
+			first = false
+		}
+		tc.Gap = tc.Mastery[tc.Leader].Current - lo
+		cmp.Topics = append(cmp.Topics, tc)
+	}
+
+	gaps := append([]TopicComparison(nil), cmp.Topics...)
+	sort.SliceStable(gaps, func(i, j int) bool { return gaps[i].Gap > gaps[j].Gap })
+	for _, tc := range gaps[:min(compareTopGaps, len(gaps))] {
+		if tc.Gap > 0 {
+			cmp.LargestGaps = append(cmp.LargestGaps, tc)
+		}
+	}
+
+	exclusive, err := getExclusiveSolves(conn, handles, limit)
+	if err != nil {
+		return cmp, err
+	}
+	cmp.Exclusive = exclusive
+	return cmp, nil
+}
+
+//problems each handle solved that none of the other handles has solved
+func getExclusiveSolves(conn *pgxpool.Pool, handles []string, limit int) (map[string][]CFProblemOutput, error) {
+	out := make(map[string][]CFProblemOutput, len(handles))
+	for _, h := range handles {
+		out[h] = []CFProblemOutput{}
+	}
+
+	rows, err := conn.Query(context.Background(), `
+		SELECT handle, problem_id, name, rating, tags, estimated, solved_count
+		FROM (
+			SELECT up.handle, p.problem_id, p.name, p.rating, COALESCE(p.tags, '{}') AS tags, p.estimated, p.solved_count,
+			       ROW_NUMBER() OVER (PARTITION BY up.handle ORDER BY up.last_attempted_at DESC) AS rn
+			FROM user_problems up
+			JOIN problems p ON p.problem_id = up.problem_id
+			WHERE up.handle = ANY($1) AND up.status = 'solved'
+			  AND NOT EXISTS (
+				SELECT 1 FROM user_problems o
+				WHERE o.problem_id = up.problem_id AND o.handle = ANY($1)
+				  AND o.handle <> up.handle AND o.status = 'solved'
+			  )
+		) ranked
+		WHERE rn <= $2
+		ORDER BY handle, rn
+	`, handles, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var handle string
+		var p CFProblemOutput
+		if err := rows.Scan(&handle, &p.ID, &p.Name, &p.Rating, &p.Tags, &p.Estimated, &p.SolvedCount); err != nil {
+			return nil, err
+		}
+		out[handle] = append(out[handle], p)
+	}
+	return out, rows.Err()
+}
@@ -3,15 +3,16 @@ package mastery
 import (
 	"container/list"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
-	"net/http"
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
+	"unicode"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/models"
@@ -19,6 +20,12 @@ import (
 
 const N = 14
 
+//gym contest ids start here; gym problems are kept for sync but never recommended
+const gymContestStart = 100000
+
+//candidates fetched per recommendation request; must exceed the deepest cursor plus k
+const recommendPoolSize = 1200
+
 func GetTagMap() map[string]string {
 	tagMap := map[string]string{
 		// foundation
@@ -145,20 +152,27 @@ func getBaseRating(rating int, attempts int) float64 {
 	return float64(rating) * modifier
 }
 
+const (
+	speedAvgMinutes = 45
+	speedFloor = 0.85
+	speedSmoothing = 10
+)
+
 func getBaseRatingTime(rating int, attempts int, timeSpentMinutes int) float64 {
 	base := getBaseRating(rating, attempts)
-	const (
-		tAvg = 45
-		floor = 0.85
-		k = 10
-	)
 
-	speedFactor := (tAvg + k)/(float64(timeSpentMinutes) + k)
+	speedFactor := (speedAvgMinutes + speedSmoothing)/(float64(timeSpentMinutes) + speedSmoothing)
 	
-	speedMultiplier := floor + (1-floor)*speedFactor
+	speedMultiplier := speedFloor + (1-speedFloor)*speedFactor
 	return base * speedMultiplier
 }
 
+//inverse of the speed multiplier in getBaseRatingTime. only meaningful above speedFloor
+func getMinutesForSpeed(speedMultiplier float64) int {
+	speedFactor := (speedMultiplier - speedFloor) / (1 - speedFloor)
+	return max(1, int(math.Round((speedAvgMinutes + speedSmoothing)/speedFactor - speedSmoothing)))
+}
+
 //calculates M given a B(j) and multipliers(j) for all j in the interval
 func calculateIntervalBin(solves []SolveAttributes) float64 {
 	if len(solves) == 0 {
@@ -304,36 +318,55 @@ func getTopicSlugs(problemTags []string, tagMap map[string]string) []string {
 	return tagSlug
 }
 
-func syncUser(conn *pgxpool.Pool, handle string, tagMap map[string]string, ancestry models.AncestryMap) error {
-	url := fmt.Sprintf("https://codeforces.com/api/user.status?handle=%s", handle)
-    resp, err := http.Get(url)
-    if err != nil {
-		return err
+//full rebuilds every bin from the whole submission history instead of only adding new solves.
+//solves logged manually keep their recorded time either way
+func syncUser(conn *pgxpool.Pool, cf CFClient, handle string, tagMap map[string]string, ancestry models.AncestryMap, full bool) error {
+	submissions, err := cf.UserStatus(handle)
+	if errors.Is(err, ErrHandleNotFound) {
+		return fmt.Errorf("handle '%s' not found or invalid: %w", handle, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch submissions for %s: %w", handle, err)
 	}
-    defer resp.Body.Close()
-
-	var data CFUserResponse
-    json.NewDecoder(resp.Body).Decode(&data)
 
-	if data.Status == "FAILED" {
-        return fmt.Errorf("handle '%s' not found or invalid", handle)
-    }
+	//handles synced before user_solves existed have bins with no events behind them, and solves
+	//synced before attempts were stored are skipped by an incremental sync, so both need a full one
+	if !full {
+		missing, err := hasMissingSolves(conn, handle)
+		if err != nil {
+			return err
+		}
+		unsummarized, err := hasMissingAttempts(conn, handle)
+		if err != nil {
+			return err
+		}
+		full = missing || unsummarized
+	}
 
-	//gets problems already solved
+	//gets problems already solved, plus solves the user deleted which sync must not bring back
     existingSolved := make(map[string]bool)
-    rows, _ := conn.Query(context.Background(), "SELECT problem_id FROM user_problems WHERE handle = $1 AND status = 'solved'", handle)
+    rows, err := conn.Query(context.Background(), "SELECT problem_id, status FROM user_problems WHERE handle = $1 AND status IN ('solved', 'excluded')", handle)
+    if err != nil {
+        return err
+    }
     for rows.Next() {
-        var id string
-        rows.Scan(&id)
-        existingSolved[id] = true
+        var id, status string
+        if err := rows.Scan(&id, &status); err != nil {
+            rows.Close()
+            return err
+        }
+        if status == "excluded" || !full {
+            existingSolved[id] = true
+        }
     }
     rows.Close()
-
-	fmt.Println("fetched all the problems needed to update. now inserting...")
+    if err := rows.Err(); err != nil {
+        return err
+    }
 
 	//fills problemHistory which contains information about all problems the user attempted which isn't in our db
     problemHistory := make(map[string][]CFSubmission)
-    for _, s := range data.Result {
+    for _, s := range submissions {
         id := fmt.Sprintf("%d%s", s.Problem.ContestID, s.Problem.Index)
         if !existingSolved[id] {
             problemHistory[id] = append(problemHistory[id], s)
@@ -348,56 +381,105 @@ func syncUser(conn *pgxpool.Pool, handle string, tagMap map[string]string, ances
 	}
     defer tx.Rollback(context.Background())
 
+	//gym problems and anything seeding skipped get a catalog row so joins and estimates see them
+	if err := insertUnknownProblems(tx, problemHistory, tagMap); err != nil {
+		return err
+	}
+
+	//problems codeforces hasn't rated yet fall back to the catalog's estimate
+	var unrated []string
+	for id, subs := range problemHistory {
+		if subs[0].Problem.Rating == 0 {
+			unrated = append(unrated, id)
+		}
+	}
+	estimated, err := loadEstimatedRatings(tx, unrated)
+	if err != nil {
+		return err
+	}
+
+	timings, err := loadSolveTimings(tx, handle, submissions)
+	if err != nil {
+		return err
+	}
+
 	problemUpserts := make([]ProblemUpsert, 0, len(problemHistory))
-	binAgg := make(map[BinKey]*BinAgg)
+	solves := make([]Submission, 0, len(problemHistory))
+	touchedBins := make(map[int]bool)
 
     for id, subs := range problemHistory {
-        var firstOK *CFSubmission
-        attempts := 0
-        for i := len(subs) - 1; i >= 0; i-- {
-			if subs[i].Verdict == "COMPILATION_ERROR" || subs[i].Verdict == "SKIPPED" || subs[i].Verdict == "TESTING" {
-				continue
-			}
-            attempts++
-            if subs[i].Verdict == "OK" {
-                firstOK = &subs[i]
-                break
-            }
-        }
+        summary := summarizeAttempts(subs)
+        firstOK := summary.FirstOK
+        attempts := summary.Attempts
 
 		if firstOK != nil {
-			solvedAt := time.Unix(firstOK.CreationTimeSeconds, 0).UTC()
+			sub := newSolve(id, summary, timings.minutes(id, *firstOK), estimated, tagMap)
+			sub.Source = "sync"
 
 			problemUpserts = append(problemUpserts, ProblemUpsert{
-				ProblemID: id, Status: "solved", T: solvedAt,
+				ProblemID: id, Status: "solved", T: sub.SolvedAt,
+				Attempts: attempts, FirstAttemptAt: summary.FirstAttemptAt, SolvedAt: &sub.SolvedAt, Verdicts: summary.Verdicts,
+				TimeSpentMinutes: sub.TimeSpentMinutes,
 			})
 
-            sub := Submission{
-                ID: id,
-                Rating: firstOK.Problem.Rating,
-                Attempts: attempts,
-                TopicSlugs: getTopicSlugs(firstOK.Problem.Tags, tagMap),
-                SolvedAt: solvedAt,
-            }
-            
-            accumulateSubmission(binAgg, sub, tagMap, ancestry)
+            solves = append(solves, sub)
+            touchedBins[getAbsoluteBinIdx(sub.SolvedAt)] = true
         } else {
 			last := subs[0]
 			lastAt := time.Unix(last.CreationTimeSeconds, 0).UTC()
 			problemUpserts = append(problemUpserts, ProblemUpsert{
 				ProblemID: id, Status: "unsolved", T: lastAt,
+				Attempts: attempts, FirstAttemptAt: summary.FirstAttemptAt, Verdicts: summary.Verdicts,
 			})
 		}
 	}
 
+	//handles from before user_solves only have their credit arrays to say how long manual solves took
+	if full {
+		imported, err := recoverLegacyMinutes(tx, handle, solves, tagMap, ancestry)
+		if err != nil {
+			return err
+		}
+		for i := range solves {
+			if m, ok := imported[solves[i].ID]; ok {
+				solves[i].TimeSpentMinutes, solves[i].Source = m, "import"
+			}
+		}
+		for i := range problemUpserts {
+			if m, ok := imported[problemUpserts[i].ProblemID]; ok {
+				problemUpserts[i].TimeSpentMinutes = m
+			}
+		}
+	}
+
 	//updating user_problems
 	err = bulkUpsertUserProblems(tx, handle, problemUpserts)
 	if err != nil {
 		return err
 	}
 	
+	//recording where each credit came from
+	err = bulkUpsertUserSolves(tx, handle, solves)
+	if err != nil {
+		return err
+	}
+
+	//a full sync has seen the whole history, so a solve still without an event never gets one
+	if full {
+		if err := demoteUnbackedSolves(tx, handle); err != nil {
+			return err
+		}
+	}
+
 	//updating user_interval_stats
-	err = bulkUpsertUserIntervalStats(tx, handle, binAgg)
+	var binIdxs []int
+	if !full {
+		binIdxs = make([]int, 0, len(touchedBins))
+		for idx := range touchedBins {
+			binIdxs = append(binIdxs, idx)
+		}
+	}
+	err = rebuildBins(tx, handle, binIdxs, tagMap, ancestry)
 	if err != nil {
 		return err
 	}
@@ -413,26 +495,99 @@ func syncUser(conn *pgxpool.Pool, handle string, tagMap map[string]string, ances
 }
 
 func accumulateSubmission(binAgg map[BinKey]*BinAgg, sub Submission, tagMap map[string]string, ancestry models.AncestryMap) {
-	base := getBaseRating(sub.Rating, sub.Attempts)
+	var base float64
+	if sub.TimeSpentMinutes > 0 {
+		base = getBaseRatingTime(sub.Rating, sub.Attempts, sub.TimeSpentMinutes)
+	} else {
+		base = getBaseRating(sub.Rating, sub.Attempts)
+	}
+	if sub.Estimated {
+		base *= EstimatedRatingDiscount
+	}
 	binIdx := getAbsoluteBinIdx(sub.SolvedAt)
 	for topic := range getTopics(tagMap) {
 		m := getMultiplier(topic, sub, ancestry)
 		if m <= 0 {
 			continue
 		}
-		credit := base * m
-
 		key := BinKey{Topic: topic, BinIdx: binIdx}
 		a := binAgg[key]
 		if a == nil {
 			a = &BinAgg{}
 			binAgg[key] = a
 		}
-		a.Credits = append(a.Credits, credit)
-		a.Multipliers = append(a.Multipliers, m)
+		a.Solves = append(a.Solves, SolveAttributes{BaseRating: base, Multiplier: m})
 	}
 }
 
+//lazily adds problems the user attempted that aren't in the catalog yet, e.g. gym problems
+//(contest id >= gymContestStart) which the problemset endpoint never returns. runs inside the
+//sync transaction so a failed sync leaves no rows behind
+func insertUnknownProblems(tx pgx.Tx, problemHistory map[string][]CFSubmission, tagMap map[string]string) error {
+	if len(problemHistory) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(problemHistory))
+	for id := range problemHistory {
+		ids = append(ids, id)
+	}
+
+	known := make(map[string]bool)
+	rows, err := tx.Query(context.Background(), "SELECT problem_id FROM problems WHERE problem_id = ANY($1)", ids)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		known[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var b pgx.Batch
+	for id, subs := range problemHistory {
+		if known[id] {
+			continue
+		}
+		p := subs[0].Problem
+		rating, estimated := p.Rating, false
+		if rating == 0 {
+			rating = EstimateRating(p.Tags, p.Index, "other", 0, tagMap)
+			estimated = true
+		}
+		topics := getTopicSlugs(p.Tags, tagMap)
+		if topics == nil {
+			topics = []string{}
+		}
+		b.Queue(`
+			INSERT INTO problems (problem_id, name, rating, tags, contest_id, problem_index, estimated, lang, gym)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (problem_id) DO NOTHING
+		`, id, p.Name, rating, topics, p.ContestID, p.Index, estimated, GetProblemLang(p.Name), p.ContestID >= gymContestStart)
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+
+	return tx.SendBatch(context.Background(), &b).Close()
+}
+
+//problems whose statement name is in cyrillic are only available in russian
+func GetProblemLang(name string) string {
+	for _, r := range name {
+		if unicode.Is(unicode.Cyrillic, r) {
+			return "ru"
+		}
+	}
+	return "en"
+}
+
 func bulkUpsertUserProblems(tx pgx.Tx, handle string, problemUpserts []ProblemUpsert) error {
 	if len(problemUpserts) == 0 {
 		return nil
@@ -440,15 +595,23 @@ func bulkUpsertUserProblems(tx pgx.Tx, handle string, problemUpserts []ProblemUp
 	var b pgx.Batch
 	for _, pu := range problemUpserts {
 		b.Queue(`
-			INSERT INTO user_problems (handle, problem_id, status, last_attempted_at)
-			VALUES ($1, $2, $3, $4)
+			INSERT INTO user_problems (handle, problem_id, status, last_attempted_at, attempts, first_attempt_at, solved_at, verdicts, time_spent_minutes)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 			ON CONFLICT (handle, problem_id) DO UPDATE SET
 				status = CASE
 					WHEN user_problems.status = 'solved' THEN 'solved'
 					ELSE EXCLUDED.status
 				END,
-				last_attempted_at = GREATEST(user_problems.last_attempted_at, EXCLUDED.last_attempted_at)
-		`, handle, pu.ProblemID, pu.Status, pu.T)
+				last_attempted_at = GREATEST(user_problems.last_attempted_at, EXCLUDED.last_attempted_at),
+				attempts = EXCLUDED.attempts,
+				first_attempt_at = EXCLUDED.first_attempt_at,
+				solved_at = COALESCE(EXCLUDED.solved_at, user_problems.solved_at),
+				verdicts = EXCLUDED.verdicts,
+				time_spent_minutes = CASE
+					WHEN EXCLUDED.time_spent_minutes > 0 THEN EXCLUDED.time_spent_minutes
+					ELSE user_problems.time_spent_minutes
+				END
+		`, handle, pu.ProblemID, pu.Status, pu.T, pu.Attempts, pu.FirstAttemptAt, pu.SolvedAt, pu.Verdicts, pu.TimeSpentMinutes)
 	}
 
 	br := tx.SendBatch(context.Background(), &b)
@@ -462,106 +625,52 @@ func bulkUpsertUserProblems(tx pgx.Tx, handle string, problemUpserts []ProblemUp
 	return nil
 }
 
-func bulkUpsertUserIntervalStats(tx pgx.Tx, handle string, binAgg map[BinKey]*BinAgg) error {
-	if len(binAgg) == 0 {
-		return nil
-	}
-	topics := make([]string, 0, len(binAgg))
-	bins := make([]int32, 0, len(binAgg))
-	for k := range binAgg {
-		topics = append(topics, k.Topic)
-		bins = append(bins, int32(k.BinIdx))
-	}
+func updateSubmissionFull(conn *pgxpool.Pool, cf CFClient, handle string, problem ProblemSolveInput, tagMap map[string]string, ancestry models.AncestryMap) error {
+	var problemStatus string
+    err := conn.QueryRow(context.Background(), 
+        "SELECT status FROM user_problems WHERE handle=$1 AND problem_id=$2", 
+        handle, problem.ProblemID).Scan(&problemStatus)
 
-	rows, err := tx.Query(context.Background(), `
-		SELECT s.topic_slug, s.bin_idx, s.credits, s.multipliers
-		FROM user_interval_stats s
-		JOIN UNNEST($2::text[], $3::int[]) AS u(topic_slug, bin_idx)
-		ON s.topic_slug = u.topic_slug AND s.bin_idx = u.bin_idx
-		WHERE s.handle = $1
-	`, handle, topics, bins)
+    if err == nil && problemStatus == "solved" {
+        return fmt.Errorf("problem %s already solved", problem.ProblemID)
+    }
 
-	if err != nil {
+	//bins are rebuilt from user_solves, so legacy handles need their events backfilled first
+	if missing, err := hasMissingSolves(conn, handle); err != nil {
 		return err
-	}
-
-	defer rows.Close()
-
-	for rows.Next() {
-		if err := rows.Err(); err != nil {
+	} else if missing {
+		if err := syncUser(conn, cf, handle, tagMap, ancestry, true); err != nil {
 			return err
 		}
-		var topic string
-		var binIdx int
-		var credits, multipliers []float64
-		if err := rows.Scan(&topic, &binIdx, &credits, &multipliers); err != nil {
-			return err
-		}
-
-		key := BinKey{Topic: topic, BinIdx: binIdx}
-		a := binAgg[key]
-		if a == nil {
-			continue
-		}
-
-		a.Credits = append(credits, a.Credits...)
-		a.Multipliers = append(multipliers, a.Multipliers...)
 	}
 
-	var b2 pgx.Batch
-	for key, a := range binAgg {
-		attributes := make([]SolveAttributes, 0, len(a.Credits))
-		for i := range a.Credits {
-			attributes = append(attributes, SolveAttributes{
-				BaseRating:  a.Credits[i] / a.Multipliers[i],
-				Multiplier:  a.Multipliers[i],
-			})
-		}
-		newBinScore := calculateIntervalBin(attributes)
-
-		b2.Queue(`
-			INSERT INTO user_interval_stats (handle, topic_slug, bin_idx, bin_score, credits, multipliers, last_updated)
-			VALUES ($1, $2, $3, $4, $5, $6, NOW())
-			ON CONFLICT (handle, topic_slug, bin_idx) DO UPDATE SET
-				bin_score = EXCLUDED.bin_score,
-				credits = EXCLUDED.credits,
-				multipliers = EXCLUDED.multipliers,
-				last_updated = NOW()
-		`, handle, key.Topic, key.BinIdx, newBinScore, a.Credits, a.Multipliers)
+	submissions, err := cf.UserStatus(handle)
+	if err != nil {
+		return fmt.Errorf("misc fail: %w", err)
 	}
 
-	br2 := tx.SendBatch(context.Background(), &b2)
-	defer br2.Close()
-	for range binAgg {
-		if _, err := br2.Exec(); err != nil {
-			return err
-		}
+	estimated, err := loadEstimatedRatings(conn, []string{problem.ProblemID})
+	if err != nil {
+		return err
 	}
 
-	return nil
-}
-
-func updateSubmissionFull(conn *pgxpool.Pool, handle string, problem ProblemSolveInput, tagMap map[string]string, ancestry models.AncestryMap) error {
-	var problemStatus string
-    err := conn.QueryRow(context.Background(), 
-        "SELECT status FROM user_problems WHERE handle=$1 AND problem_id=$2", 
-        handle, problem.ProblemID).Scan(&problemStatus)
-
-    if err == nil && problemStatus == "solved" {
-        return fmt.Errorf("problem %s already solved", problem.ProblemID)
-    }
-
-	sub, err := hydrateSubmission(handle, problem, tagMap)
-    if err != nil {
-        return err
-    }
-
 	tx, err := conn.Begin(context.Background())
     if err != nil {
 		return err
 	}
     defer tx.Rollback(context.Background())
 
+	//the same timing sources as sync, so a timed solve credits exactly what sync would
+	timings, err := loadSolveTimings(tx, handle, submissions)
+	if err != nil {
+		return err
+	}
+
+	sub, err := hydrateSubmission(submissions, problem, timings, estimated, tagMap)
+    if err != nil {
+        return err
+    }
+
 	err = updateSubmission(tx, handle, sub, tagMap, ancestry)
 	if err != nil {
 		return err
@@ -572,7 +681,7 @@ func updateSubmissionFull(conn *pgxpool.Pool, handle string, problem ProblemSolv
 	if err != nil {
 		return err
 	}
-	if err := refreshAllTopicMasteryBatch(tx, handle, nowBinIdx, topics); err != nil {
+	if err := fillAllTopicMasteryBatch(tx, handle, nowBinIdx, topics); err != nil {
 		return err
 	}
 
@@ -583,45 +692,28 @@ func updateSubmissionFull(conn *pgxpool.Pool, handle string, problem ProblemSolv
 func updateSubmission(tx pgx.Tx, handle string, submission Submission, tagMap map[string]string, ancestry models.AncestryMap) error {
 
 	_, err := tx.Exec(context.Background(), `
-		INSERT INTO user_problems (handle, problem_id, status, last_attempted_at)
-		VALUES ($1, $2, 'solved', $3)
+		INSERT INTO user_problems (handle, problem_id, status, last_attempted_at, attempts, first_attempt_at, solved_at, verdicts, time_spent_minutes, reported_minutes)
+		VALUES ($1, $2, 'solved', $3, $4, $5, $3, $6, $7, NULLIF($8, 0))
 		ON CONFLICT (handle, problem_id) DO UPDATE SET
 			status = 'solved',
-			last_attempted_at = EXCLUDED.last_attempted_at
-	`, handle, submission.ID, submission.SolvedAt.UTC())
+			last_attempted_at = EXCLUDED.last_attempted_at,
+			attempts = EXCLUDED.attempts,
+			first_attempt_at = EXCLUDED.first_attempt_at,
+			solved_at = EXCLUDED.solved_at,
+			verdicts = EXCLUDED.verdicts,
+			time_spent_minutes = EXCLUDED.time_spent_minutes,
+			reported_minutes = EXCLUDED.reported_minutes
+	`, handle, submission.ID, submission.SolvedAt.UTC(), submission.Attempts, submission.FirstAttemptAt, submission.Verdicts, submission.TimeSpentMinutes, submission.ReportedMinutes)
 	if err != nil {
 		return err
 	}
 
-	binAgg := make(map[BinKey]*BinAgg)
-
-	var base float64
-	if submission.TimeSpentMinutes > 0 {
-		base = getBaseRatingTime(submission.Rating, submission.Attempts, submission.TimeSpentMinutes)
-	} else {
-		base = getBaseRating(submission.Rating, submission.Attempts)
+	submission.Source = "manual"
+	if err := bulkUpsertUserSolves(tx, handle, []Submission{submission}); err != nil {
+		return err
 	}
-	binIdx := getAbsoluteBinIdx(submission.SolvedAt)
-
-	for topic := range getTopics(tagMap) {
-		m := getMultiplier(topic, submission, ancestry)
-		if m <= 0 {
-			continue
-		}
-		credit := base * m
-
-		key := BinKey{Topic: topic, BinIdx: binIdx}
-		a := binAgg[key]
-
-		if a == nil{
-			a = &BinAgg{}
-			binAgg[key] = a
-		}
 
-		a.Credits = append(a.Credits, credit)
-		a.Multipliers = append(a.Multipliers, m)
-	}
-	return bulkUpsertUserIntervalStats(tx, handle, binAgg)
+	return rebuildBins(tx, handle, []int{getAbsoluteBinIdx(submission.SolvedAt)}, tagMap, ancestry)
 }
 
 func getAllStats(conn *pgxpool.Pool, handle string) (map[string]MasteryResult, error) {
@@ -689,6 +781,7 @@ func loadAllTopicBins(tx pgx.Tx, handle string, tagMap map[string]string) (map[s
 	return out, nil
 }
 
+//recomputes current and peak mastery from the bins, so a removed solve also lowers a peak it had set
 func fillAllTopicMasteryBatch(tx pgx.Tx, handle string, nowBinIdx int, topics map[string]map[int]float64) error {
 	var b pgx.Batch
 	for topic, binMap := range topics {
@@ -716,33 +809,6 @@ func fillAllTopicMasteryBatch(tx pgx.Tx, handle string, nowBinIdx int, topics ma
 	return nil
 }
 
-func refreshAllTopicMasteryBatch(tx pgx.Tx, handle string, nowBinIdx int, topics map[string]map[int]float64) error {
-	var b pgx.Batch
-	for topic, binMap := range topics {
-		scores := getTopicScoresArr(nowBinIdx, binMap)
-		cur := calculateMasteryCurrentScore(scores)
-
-		b.Queue(`
-			INSERT INTO user_topic_stats (handle, topic_slug, mastery_score, peak_score, last_updated)
-			VALUES ($1, $2, $3, $3, NOW())
-			ON CONFLICT (handle, topic_slug) DO UPDATE SET
-				mastery_score = EXCLUDED.mastery_score,
-				peak_score = GREATEST(user_topic_stats.peak_score, EXCLUDED.mastery_score),
-				last_updated = NOW()
-		`, handle, topic, cur)
-	}
-
-	br := tx.SendBatch(context.Background(), &b)
-	defer br.Close()
-
-	for range topics {
-		if _, err := br.Exec(); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func getTopicScoresArr(currentBinIdx int, binMap map[int]float64) []float64 {
 	var scores []float64
 	if len(binMap) == 0 {
@@ -761,23 +827,10 @@ func getTopicScoresArr(currentBinIdx int, binMap map[int]float64) []float64 {
 	return scores
 }
 
-func hydrateSubmission(handle string, problem ProblemSolveInput, tagMap map[string]string) (Submission, error) {
-	url := fmt.Sprintf("https://codeforces.com/api/user.status?handle=%s", handle)
-	resp, err := http.Get(url)
-	if err != nil {
-		return Submission{}, fmt.Errorf("misc fail: %w", err)
-	}
-	defer resp.Body.Close()
-
-	var data CFUserResponse
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return Submission{}, fmt.Errorf("misc fail: %w", err)
-	}
-
-	if data.Status != "OK" {
-		return Submission{}, fmt.Errorf("misc fail")
-	}
-
+//builds the solve for a manual submit from the user's codeforces history. server-side timings
+//win, and the minutes the user reported only time a solve nothing else timed. the reported value
+//is kept on the solve either way
+func hydrateSubmission(submissions []CFSubmission, problem ProblemSolveInput, timings solveTimings, estimated map[string]int, tagMap map[string]string) (Submission, error) {
 	re := regexp.MustCompile(`^(\d+)([A-Za-z0-9]+)$`)
 	matches := re.FindStringSubmatch(problem.ProblemID)
 	if len(matches) != 3 {
@@ -787,92 +840,145 @@ func hydrateSubmission(handle string, problem ProblemSolveInput, tagMap map[stri
 	targetIndex := matches[2]
 
 	var problemSubs []CFSubmission
-	for _, s := range data.Result {
+	for _, s := range submissions {
 		if s.Problem.ContestID == targetContestID && s.Problem.Index == targetIndex {
 			problemSubs = append(problemSubs, s)
 		}
 	}
 
-	attempts := 0
-	var firstOK *CFSubmission
+	summary := summarizeAttempts(problemSubs)
+	if summary.FirstOK == nil {
+		return Submission{}, fmt.Errorf("problem %s has not been solved", problem.ProblemID)
+	}
 
-	for i := len(problemSubs) - 1; i >= 0; i-- {
-		s := problemSubs[i]
-		
-		if s.Verdict == "COMPILATION_ERROR" || s.Verdict == "SKIPPED" || s.Verdict == "TESTING" {
+	minutes := timings.minutes(problem.ProblemID, *summary.FirstOK)
+	if minutes == 0 {
+		minutes = max(problem.TimeSpentMinutes, 0)
+	}
+	sub := newSolve(problem.ProblemID, summary, minutes, estimated, tagMap)
+	sub.ReportedMinutes = max(problem.TimeSpentMinutes, 0)
+	return sub, nil
+}
+
+//true when a solved problem predates attempt tracking; every solve has at least one judged attempt
+func hasMissingAttempts(conn *pgxpool.Pool, handle string) (bool, error) {
+	var missing bool
+	err := conn.QueryRow(context.Background(), `
+		SELECT EXISTS (
+			SELECT 1 FROM user_problems
+			WHERE handle = $1 AND status = 'solved' AND attempts = 0
+		)
+	`, handle).Scan(&missing)
+	return missing, err
+}
+
+//walks a problem's submissions (newest first, as codeforces returns them) from the oldest up to
+//the first accepted one. compilation errors, skipped and still-testing runs don't count as attempts
+func summarizeAttempts(subs []CFSubmission) AttemptSummary {
+	summary := AttemptSummary{Verdicts: make(map[string]int)}
+	for i := len(subs) - 1; i >= 0; i-- {
+		s := subs[i]
+		if s.Verdict == "TESTING" {
 			continue
 		}
-		
-		attempts++
-		
+		if summary.FirstAttemptAt == nil {
+			t := time.Unix(s.CreationTimeSeconds, 0).UTC()
+			summary.FirstAttemptAt = &t
+		}
+		summary.Verdicts[s.Verdict]++
+
+		if s.Verdict == "COMPILATION_ERROR" || s.Verdict == "SKIPPED" {
+			continue
+		}
+		summary.Attempts++
 		if s.Verdict == "OK" {
-			firstOK = &s
+			summary.FirstOK = &subs[i]
 			break
 		}
 	}
-	if firstOK == nil {
-		return Submission{}, fmt.Errorf("problem %s has not been solved", problem.ProblemID)
-	}
-
-	rating := firstOK.Problem.Rating
-
-	tags := getTopicSlugs(firstOK.Problem.Tags, tagMap)
-
-    return Submission{
-        ID: problem.ProblemID,
-        Rating: rating,
-        Attempts: attempts,
-        TopicSlugs: tags,
-        TimeSpentMinutes: problem.TimeSpentMinutes,
-        SolvedAt: time.Unix(firstOK.CreationTimeSeconds, 0),
-    }, nil
+	return summary
 }
 
-func recommendProblem(conn *pgxpool.Pool, handle string, topic string, targetInc int, k int) ([]CFProblemOutput, error) {
-	userRatings := make(map[string]int)
-	
-	rows, err := conn.Query(context.Background(), `
-		SELECT topic_slug, CAST(mastery_score AS INTEGER) 
-		FROM user_topic_stats 
-		WHERE handle = $1`, handle)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch user stats: %w", err)
+func recommendProblem(conn *pgxpool.Pool, handle string, topics []string, opts RecommendOptions) ([]CFProblemOutput, error) {
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("at least one topic is required")
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var slug string
-		var score int
-		if err := rows.Scan(&slug, &score); err != nil {
-			return nil, err
-		}
-		userRatings[slug] = score
+	//a group is rated as one player whose topic mastery is the min, mean or max of the members'
+	handles := []string{handle}
+	if len(opts.Group) > 0 {
+		handles = opts.Group
+	}
+
+	userRatings, err := getGroupRatings(conn, handles, opts.GroupTarget)
+	if err != nil {
+		return nil, err
 	}
 
-	currentMainRating := max(userRatings[topic], 800)
+	currentMainRating := getCombinedRating(topics, userRatings)
 
-	targetRating := currentMainRating + targetInc
+	targetRating := currentMainRating + opts.TargetInc
 	targetRating = max(targetRating, 800)
+
+	//both operators are served by the GIN index on tags
+	tagCond := "tags @> $1::text[]"
+	if opts.Mode == "any" {
+		tagCond = "tags && $1::text[]"
+	}
+	
+	filterCond, filterArgs := getProblemFilterSQL(opts.Filter, 10)
 	
 	query := `
-		SELECT problem_id, name, rating, tags
+		SELECT problem_id, name, rating, tags, estimated, solved_count
 		FROM problems p
-		WHERE $1 = ANY(tags)
+		WHERE ` + tagCond + `
 		AND rating BETWEEN $2 AND $3
 		AND NOT EXISTS (
 			SELECT 1 FROM user_problems up
-			WHERE up.handle = $4 
+			WHERE LOWER(up.handle) = ANY($4)
 			AND up.problem_id = p.problem_id
-			AND up.status = 'solved'
+			AND ($9::bool OR up.status = 'solved')
 		)
-		ORDER BY ABS(rating - $5) ASC
-		LIMIT 200
+		AND NOT (tags && $6::text[])
+		AND ($8::bool OR NOT estimated)
+		AND NOT gym
+	` + filterCond + `
+		ORDER BY ABS(rating - $5) ASC, ` + getPopularityOrder(targetRating) + `problem_id
+		LIMIT $7
 	`
 
 	minRating := max(targetRating - 200, 800)
+	if opts.MinRating > 0 {
+		minRating = opts.MinRating
+	}
 	maxRating := targetRating + 200
+	if opts.MaxRating > 0 {
+		maxRating = opts.MaxRating
+	}
+	//a single bound set past the default window drags the other one along rather than leaving nothing
+	if opts.MaxRating == 0 && minRating > maxRating {
+		maxRating = minRating + 400
+	}
+	if opts.MinRating == 0 && maxRating < minRating {
+		minRating = maxRating - 400
+	}
 
-	pRows, err := conn.Query(context.Background(), query, topic, minRating, maxRating, handle, targetRating)
+	excludeTags := opts.ExcludeTags
+	if excludeTags == nil {
+		excludeTags = []string{}
+	}
+
+	//a group practice needs problems fresh to everyone, so any attempt by a member rules a problem out
+	excludeAttempted := len(opts.Group) > 0
+	//every page draws from the same pool, so the greedy re-ranking for a deeper page
+	//extends the one for a shallower page instead of reshuffling it
+	//member handles are stored as typed, so they are matched case-insensitively like everywhere else
+	lowered := make([]string, len(handles))
+	for i, h := range handles {
+		lowered[i] = strings.ToLower(h)
+	}
+	args := append([]any{topics, minRating, maxRating, lowered, targetRating, excludeTags, recommendPoolSize, !opts.ExcludeEstimated, excludeAttempted}, filterArgs...)
+	pRows, err := conn.Query(context.Background(), query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -881,32 +987,33 @@ func recommendProblem(conn *pgxpool.Pool, handle string, topic string, targetInc
 	var candidates []CFProblemOutput
 	for pRows.Next() {
 		var p CFProblemOutput
-		if err := pRows.Scan(&p.ID, &p.Name, &p.Rating, &p.Tags); err != nil {
+		if err := pRows.Scan(&p.ID, &p.Name, &p.Rating, &p.Tags, &p.Estimated, &p.SolvedCount); err != nil {
 			return nil, err
 		}
 		candidates = append(candidates, p)
 	}
 
-	finalRecommendations := make([]CFProblemOutput, 0, k)
+	//every candidate passing the tag filter, tightest margin first
+	eligible := make([]CFProblemOutput, 0, len(candidates))
+	tiers := make([]int, 0, len(candidates))
 	added := make(map[string]bool)
 
+	requested := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		requested[topic] = true
+	}
+
 	margins := []int{50, 100, 150, 200, 300, 500, 1000}
 
-	for _, margin := range margins {
-		if len(finalRecommendations) >= k {
-			break
-		}
+	for tier, margin := range margins {
 		for _, problem := range candidates {
-			if len(finalRecommendations) >= k {
-				break
-			}
 			if added[problem.ID] {
 				continue
 			}
 			canAdd := true
 			
 			for _, tag := range problem.Tags {
-				if tag == topic {
+				if requested[tag] {
 					continue
 				}
 
@@ -919,12 +1026,188 @@ func recommendProblem(conn *pgxpool.Pool, handle string, topic string, targetInc
 			}
 
 			if canAdd {
-				finalRecommendations = append(finalRecommendations, problem)
+				eligible = append(eligible, problem)
+				tiers = append(tiers, tier)
 				added[problem.ID] = true
 			}
 		}
 	}
-	return finalRecommendations, nil
+	relevance := getRecommendRelevance(eligible, tiers, len(margins), targetRating)
+	ranked := diversifyRecommendations(eligible, relevance, opts.Offset+opts.K, opts.Diversity)
+	if opts.Offset >= len(ranked) {
+		return []CFProblemOutput{}, nil
+	}
+	return ranked[opts.Offset:], nil
+}
+
+//breaks rating ties by popularity: beginners get well-tested problems with many solves,
+//advanced users get the obscure ones they are less likely to have seen
+func getPopularityOrder(targetRating int) string {
+	switch {
+	case targetRating < 1400:
+		return "solved_count DESC, "
+	case targetRating >= 2100:
+		return "solved_count ASC, "
+	}
+	return ""
+}
+
+//topic -> mastery for the handles combined by target (min, mean or max). a handle with no row
+//for a topic counts as 0 there. a single handle is just its own mastery. matching is case-insensitive
+func getGroupRatings(conn *pgxpool.Pool, handles []string, target string) (map[string]int, error) {
+	lowered := make([]string, len(handles))
+	for i, h := range handles {
+		lowered[i] = strings.ToLower(h)
+	}
+	rows, err := conn.Query(context.Background(), `
+		SELECT LOWER(handle), topic_slug, mastery_score
+		FROM user_topic_stats
+		WHERE LOWER(handle) = ANY($1)`, lowered)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user stats: %w", err)
+	}
+	defer rows.Close()
+
+	scores := make(map[string]map[string]float64)
+	for rows.Next() {
+		var handle, slug string
+		var score float64
+		if err := rows.Scan(&handle, &slug, &score); err != nil {
+			return nil, err
+		}
+		if scores[slug] == nil {
+			scores[slug] = make(map[string]float64)
+		}
+		scores[slug][handle] = score
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ratings := make(map[string]int, len(scores))
+	for slug, byHandle := range scores {
+		var agg float64
+		for i, h := range lowered {
+			score := byHandle[h]
+			switch {
+			case i == 0:
+				agg = score
+			case target == "min":
+				agg = math.Min(agg, score)
+			case target == "max":
+				agg = math.Max(agg, score)
+			default:
+				agg += score
+			}
+		}
+		if target != "min" && target != "max" {
+			agg /= float64(len(handles))
+		}
+		ratings[slug] = int(agg)
+	}
+	return ratings, nil
+}
+
+//combines mastery across requested topics with weights inversely proportional to each rating,
+//so the target leans toward the weakest topic in the set. a single topic gives its own rating
+func getCombinedRating(topics []string, userRatings map[string]int) int {
+	var weightSum float64
+	for _, topic := range topics {
+		weightSum += 1 / float64(max(userRatings[topic], 800))
+	}
+	return int(float64(len(topics)) / weightSum)
+}
+
+//relevance in [0, 1] from how close a problem is to the target, relative to the farthest
+//candidate, and how loose a margin its other tags needed. the pool size doesn't change it
+func getRecommendRelevance(eligible []CFProblemOutput, tiers []int, tierCount int, targetRating int) []float64 {
+	spread := 100.0
+	for _, p := range eligible {
+		spread = math.Max(spread, math.Abs(float64(p.Rating-targetRating)))
+	}
+	relevance := make([]float64, len(eligible))
+	for i, p := range eligible {
+		dist := math.Abs(float64(p.Rating-targetRating)) / spread
+		tier := float64(tiers[i]) / float64(max(tierCount-1, 1))
+		relevance[i] = 1 - (dist+tier)/2
+	}
+	return relevance
+}
+
+//maximal marginal relevance over the eligible list. each pick is penalized by its similarity to
+//the closest problem already picked; equal scores keep the list order
+func diversifyRecommendations(eligible []CFProblemOutput, relevance []float64, k int, diversity float64) []CFProblemOutput {
+	if k <= 0 || len(eligible) == 0 {
+		return []CFProblemOutput{}
+	}
+	k = min(k, len(eligible))
+	diversity = math.Min(math.Max(diversity, 0), 1)
+
+	picked := make([]CFProblemOutput, 0, k)
+	used := make([]bool, len(eligible))
+	//similarity of each candidate to its closest pick so far, updated as picks are made
+	maxSim := make([]float64, len(eligible))
+
+	for len(picked) < k {
+		best := -1
+		bestScore := math.Inf(-1)
+		for i := range eligible {
+			if used[i] {
+				continue
+			}
+			score := (1-diversity)*relevance[i] - diversity*maxSim[i]
+			if score > bestScore {
+				best = i
+				bestScore = score
+			}
+		}
+		used[best] = true
+		picked = append(picked, eligible[best])
+		for i, problem := range eligible {
+			if !used[i] {
+				maxSim[i] = math.Max(maxSim[i], problemSimilarity(problem, eligible[best]))
+			}
+		}
+	}
+	return picked
+}
+
+//similarity in [0, 1] from shared contest, overlapping tags and near-identical rating
+func problemSimilarity(a CFProblemOutput, b CFProblemOutput) float64 {
+	var sim float64
+	if getContestID(a.ID) == getContestID(b.ID) {
+		sim += 0.5
+	}
+
+	tagSet := make(map[string]bool, len(a.Tags))
+	for _, tag := range a.Tags {
+		tagSet[tag] = true
+	}
+	shared := 0
+	for _, tag := range b.Tags {
+		if tagSet[tag] {
+			shared++
+		}
+	}
+	if union := len(a.Tags) + len(b.Tags) - shared; union > 0 {
+		sim += 0.3 * float64(shared) / float64(union)
+	}
+
+	const ratingWindow = 100
+	if diff := math.Abs(float64(a.Rating - b.Rating)); diff < ratingWindow {
+		sim += 0.2 * (1 - diff/ratingWindow)
+	}
+	return sim
+}
+
+//contest id is the numeric prefix of a problem id, e.g. 1850 for 1850G
+func getContestID(problemID string) int {
+	end := 0
+	for end < len(problemID) && problemID[end] >= '0' && problemID[end] <= '9' {
+		end++
+	}
+	id, _ := strconv.Atoi(problemID[:end])
+	return id
 }
 
 func recommendDailyProblem(conn *pgxpool.Pool, handle string) (CFProblemOutput, error) {
@@ -932,6 +1215,7 @@ func recommendDailyProblem(conn *pgxpool.Pool, handle string) (CFProblemOutput,
 		Slug string
 		Current int
 		Decay int
+		FailureRate float64
 	}
 
 	rows, err := conn.Query(context.Background(), `
@@ -954,8 +1238,20 @@ func recommendDailyProblem(conn *pgxpool.Pool, handle string) (CFProblemOutput,
 		activeTopics = append(activeTopics, t)
 	}
 
+	verdicts, err := getVerdictStats(conn, handle)
+	if err != nil {
+		return CFProblemOutput{}, fmt.Errorf("failed to fetch verdicts: %w", err)
+	}
+	failureRates := make(map[string]float64, len(verdicts))
+	for _, v := range verdicts {
+		failureRates[v.Topic] = v.FailureRate
+	}
+	for i := range activeTopics {
+		activeTopics[i].FailureRate = failureRates[activeTopics[i].Slug]
+	}
+
 	fallback := func() (CFProblemOutput, error) {
-		res, err := recommendProblem(conn, handle, "implementation", 100, 1)
+		res, err := recommendProblem(conn, handle, []string{"implementation"}, RecommendOptions{TargetInc: 100, K: 1, Filter: ProblemFilter{Lang: "en"}})
 		if err != nil {
 			return CFProblemOutput{}, err
 		}
@@ -972,20 +1268,28 @@ func recommendDailyProblem(conn *pgxpool.Pool, handle string) (CFProblemOutput,
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	roll := r.Intn(100)
 
-	if roll < 50 {
+	if roll < 45 {
 		sort.Slice(activeTopics, func(i int, j int) bool {
 			if activeTopics[i].Decay != activeTopics[j].Decay {
 				return activeTopics[i].Decay > activeTopics[j].Decay
 			}
 			return activeTopics[i].Current < activeTopics[j].Current
 		})
-	} else if roll < 80 {
+	} else if roll < 70 {
 		sort.Slice(activeTopics, func(i int, j int) bool {
 			if activeTopics[i].Decay != activeTopics[j].Decay {
 				return activeTopics[i].Decay < activeTopics[j].Decay
 			}
 			return activeTopics[i].Current > activeTopics[j].Current
 		})
+	} else if roll < 85 {
+		//topics where the user keeps failing submissions
+		sort.Slice(activeTopics, func(i int, j int) bool {
+			if activeTopics[i].FailureRate != activeTopics[j].FailureRate {
+				return activeTopics[i].FailureRate > activeTopics[j].FailureRate
+			}
+			return activeTopics[i].Current < activeTopics[j].Current
+		})
 	} else {
 		r.Shuffle(len(activeTopics), func(i int, j int) {
 			activeTopics[i], activeTopics[j] = activeTopics[j], activeTopics[i]
@@ -1000,7 +1304,7 @@ func recommendDailyProblem(conn *pgxpool.Pool, handle string) (CFProblemOutput,
 	})
 
 	for _, topic := range candidates {
-		recommendations, err := recommendProblem(conn, handle, topic.Slug, 100, 1)
+		recommendations, err := recommendProblem(conn, handle, []string{topic.Slug}, RecommendOptions{TargetInc: 100, K: 1, Filter: ProblemFilter{Lang: "en"}})
 		
 		if err == nil && len(recommendations) > 0 {
 			return recommendations[0], nil
@@ -1011,9 +1315,10 @@ func recommendDailyProblem(conn *pgxpool.Pool, handle string) (CFProblemOutput,
 
 func getLastKSolves(conn *pgxpool.Pool, handle string, k int, status string) ([]CFSolveOutput, error ) {
 	query := `
-        SELECT p.problem_id, p.name, p.rating, p.tags, up.last_attempted_at 
+        SELECT up.problem_id, COALESCE(p.name, ''), COALESCE(p.rating, 0), COALESCE(p.tags, '{}'), up.last_attempted_at,
+               up.attempts, up.first_attempt_at, up.solved_at, up.verdicts, up.time_spent_minutes, up.reported_minutes
         FROM user_problems up
-        JOIN problems p ON up.problem_id = p.problem_id
+        LEFT JOIN problems p ON up.problem_id = p.problem_id
         WHERE up.handle = $1 AND up.status = $3
         ORDER BY up.last_attempted_at DESC 
         LIMIT $2
@@ -1028,7 +1333,8 @@ func getLastKSolves(conn *pgxpool.Pool, handle string, k int, status string) ([]
 	var recentSolves []CFSolveOutput
     for rows.Next() {
         var p CFSolveOutput
-        if err := rows.Scan(&p.ID, &p.Name, &p.Rating, &p.Tags, &p.SolvedAt); err != nil {
+        if err := rows.Scan(&p.ID, &p.Name, &p.Rating, &p.Tags, &p.SolvedAt,
+            &p.Attempts, &p.FirstAttemptAt, &p.AcceptedAt, &p.Verdicts, &p.TimeSpentMinutes, &p.ReportedMinutes); err != nil {
             return nil, err
         }
         recentSolves = append(recentSolves, p)
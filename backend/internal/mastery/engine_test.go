@@ -0,0 +1,121 @@
+package mastery
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestDiversifyRecommendations(t *testing.T) {
+	//a default-window pool around 1500 in the order the query returns it
+	pool := []CFProblemOutput{
+		{ID: "1500A", Rating: 1500, Tags: []string{"dp"}},
+		{ID: "1501B", Rating: 1500, Tags: []string{"dp"}},
+		{ID: "1502C", Rating: 1550, Tags: []string{"dp"}},
+		{ID: "1503D", Rating: 1450, Tags: []string{"dp"}},
+		{ID: "1504E", Rating: 1600, Tags: []string{"dp"}},
+		{ID: "1505F", Rating: 1400, Tags: []string{"dp"}},
+		{ID: "1506G", Rating: 1700, Tags: []string{"dp"}},
+		{ID: "1507H", Rating: 1300, Tags: []string{"dp"}},
+	}
+	flat := make([]int, len(pool))
+
+	tests := []struct {
+		name string
+		eligible []CFProblemOutput
+		tiers []int
+		k int
+		diversity float64
+		want []string
+	}{
+		{"default diversity stays near the target", pool, flat, 4, 0.3, []string{"1500A", "1501B", "1502C", "1503D"}},
+		{"no diversity keeps rating order", pool, flat, 8, 0, []string{"1500A", "1501B", "1502C", "1503D", "1504E", "1505F", "1506G", "1507H"}},
+		{"full diversity spreads the ratings", pool, flat, 3, 1, []string{"1500A", "1504E", "1505F"}},
+		{
+			"same contest is pushed back",
+			[]CFProblemOutput{
+				{ID: "1500A", Rating: 1500, Tags: []string{"dp"}},
+				{ID: "1500B", Rating: 1500, Tags: []string{"dp"}},
+				{ID: "1501A", Rating: 1550, Tags: []string{"dp"}},
+			},
+			[]int{0, 0, 0}, 2, 0.3, []string{"1500A", "1501A"},
+		},
+		{
+			"a looser margin ranks below a close tight one",
+			[]CFProblemOutput{
+				{ID: "1500A", Rating: 1500, Tags: []string{"dp", "graphs"}},
+				{ID: "1501A", Rating: 1550, Tags: []string{"dp"}},
+				{ID: "1502A", Rating: 1300, Tags: []string{"dp"}},
+			},
+			[]int{6, 0, 0}, 3, 0, []string{"1501A", "1500A", "1502A"},
+		},
+		{"k past the pool returns everything", pool[:2], flat[:2], 5, 0.3, []string{"1500A", "1501B"}},
+		{"empty pool", nil, nil, 3, 0.3, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			relevance := getRecommendRelevance(tt.eligible, tt.tiers, 7, 1500)
+			got := []string{}
+			for _, p := range diversifyRecommendations(tt.eligible, relevance, tt.k, tt.diversity) {
+				got = append(got, p.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSummarizeAttempts(t *testing.T) {
+	//codeforces lists submissions newest first; run takes them oldest first for readability
+	run := func(verdicts ...string) []CFSubmission {
+		subs := make([]CFSubmission, len(verdicts))
+		for i, v := range verdicts {
+			subs[len(verdicts)-1-i] = CFSubmission{Verdict: v, CreationTimeSeconds: int64(100 * (i + 1))}
+		}
+		return subs
+	}
+
+	tests := []struct {
+		name string
+		subs []CFSubmission
+		attempts int
+		firstAttempt int64 //0 when nothing was judged
+		acceptedAt int64 //0 when unsolved
+		verdicts map[string]int
+	}{
+		{"accepted first try", run("OK"), 1, 100, 100, map[string]int{"OK": 1}},
+		{"rejections count up to the accept", run("WRONG_ANSWER", "TIME_LIMIT_EXCEEDED", "OK"), 3, 100, 300, map[string]int{"WRONG_ANSWER": 1, "TIME_LIMIT_EXCEEDED": 1, "OK": 1}},
+		{"compilation errors and skipped runs aren't attempts", run("COMPILATION_ERROR", "SKIPPED", "OK"), 1, 100, 300, map[string]int{"COMPILATION_ERROR": 1, "SKIPPED": 1, "OK": 1}},
+		{"runs still testing are ignored", run("TESTING", "WRONG_ANSWER", "OK"), 2, 200, 300, map[string]int{"WRONG_ANSWER": 1, "OK": 1}},
+		{"runs after the first accept are ignored", run("OK", "WRONG_ANSWER", "OK"), 1, 100, 100, map[string]int{"OK": 1}},
+		{"unsolved counts every judged run", run("WRONG_ANSWER", "COMPILATION_ERROR", "RUNTIME_ERROR"), 2, 100, 0, map[string]int{"WRONG_ANSWER": 1, "COMPILATION_ERROR": 1, "RUNTIME_ERROR": 1}},
+		{"nothing judged yet", run("TESTING"), 0, 0, 0, map[string]int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := summarizeAttempts(tt.subs)
+			if got.Attempts != tt.attempts {
+				t.Errorf("attempts: got %d, want %d", got.Attempts, tt.attempts)
+			}
+			var firstAttempt, acceptedAt int64
+			if got.FirstAttemptAt != nil {
+				firstAttempt = got.FirstAttemptAt.Unix()
+			}
+			if got.FirstOK != nil {
+				acceptedAt = got.FirstOK.CreationTimeSeconds
+			}
+			if firstAttempt != tt.firstAttempt {
+				t.Errorf("first attempt: got %d, want %d", firstAttempt, tt.firstAttempt)
+			}
+			if acceptedAt != tt.acceptedAt {
+				t.Errorf("accepted at: got %d, want %d", acceptedAt, tt.acceptedAt)
+			}
+			if !maps.Equal(got.Verdicts, tt.verdicts) {
+				t.Errorf("verdicts: got %v, want %v", got.Verdicts, tt.verdicts)
+			}
+		})
+	}
+}
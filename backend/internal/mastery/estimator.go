@@ -0,0 +1,81 @@
+package mastery
+
+import (
+	"context"
+	"math"
+)
+
+//credit from a solve whose rating was estimated is scaled by this, since the estimate can be off
+const EstimatedRatingDiscount = 0.9
+
+//rating of problem A and the step per later letter, by division
+var divisionLadder = map[string][2]int{
+	"div4": {800, 200},
+	"div3": {800, 250},
+	"div2": {800, 350},
+	"educational": {800, 300},
+	"div1+2": {900, 350},
+	"global": {900, 350},
+	"div1": {1500, 350},
+	"other": {1000, 300},
+}
+
+//predicts a rating for a problem codeforces hasn't rated yet. the index letter and division
+//set the baseline, the solve count moves it (popular problems are easier), and tags that
+//map to advanced topics push it up
+func EstimateRating(tags []string, index string, division string, solvedCount int, tagMap map[string]string) int {
+	ladder, ok := divisionLadder[division]
+	if !ok {
+		ladder = divisionLadder["other"]
+	}
+
+	letter := 0
+	if len(index) > 0 && index[0] >= 'A' && index[0] <= 'Z' {
+		letter = int(index[0] - 'A')
+	}
+	estimate := float64(ladder[0] + letter*ladder[1])
+
+	//~1000 solves is typical for a mid-round problem; each 10x away shifts the estimate by 150
+	if solvedCount > 0 {
+		shift := -150 * (math.Log10(float64(solvedCount)) - 3)
+		estimate += math.Max(-400, math.Min(400, shift))
+	}
+
+	for _, topic := range getTopicSlugs(tags, tagMap) {
+		if topic == "advanced math" || topic == "advanced graphs" || topic == "advanced strings" {
+			estimate += 150
+			break
+		}
+	}
+
+	rounded := int(math.Round(estimate/100)) * 100
+	return min(max(rounded, 800), 3500)
+}
+
+//looks up catalog ratings for problems codeforces reported as unrated. only estimated rows are returned
+func loadEstimatedRatings(q queryer, ids []string) (map[string]int, error) {
+	out := make(map[string]int)
+	if len(ids) == 0 {
+		return out, nil
+	}
+
+	rows, err := q.Query(context.Background(), `
+		SELECT problem_id, rating
+		FROM problems
+		WHERE problem_id = ANY($1) AND estimated
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var rating int
+		if err := rows.Scan(&id, &rating); err != nil {
+			return nil, err
+		}
+		out[id] = rating
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,35 @@
+package mastery
+
+import "testing"
+
+func TestEstimateRating(t *testing.T) {
+	tagMap := GetTagMap()
+	tests := []struct {
+		name string
+		tags []string
+		index string
+		division string
+		solvedCount int
+		want int
+	}{
+		{"div2 C without solve data", []string{"greedy"}, "C", "div2", 0, 1500},
+		{"typical solve count leaves the ladder alone", []string{"greedy"}, "C", "div2", 1000, 1500},
+		{"popular problem is easier", []string{"greedy"}, "C", "div2", 10000, 1400},
+		{"floored at 800", []string{"implementation"}, "A", "div2", 100000, 800},
+		{"rarely solved problem is harder", []string{"dp"}, "E", "div1", 10, 3200},
+		{"capped at 3500", []string{"dp"}, "H", "div1", 1, 3500},
+		{"half steps round up", []string{"math"}, "B", "div3", 0, 1100},
+		{"advanced topic adds 150", []string{"fft"}, "B", "div3", 0, 1200},
+		{"advanced bump applies once", []string{"fft", "flows"}, "B", "div3", 0, 1200},
+		{"unknown division uses the generic ladder", []string{"math"}, "A", "", 0, 1000},
+		{"numeric index counts as A", []string{"math"}, "1", "educational", 0, 800},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateRating(tt.tags, tt.index, tt.division, tt.solvedCount, tagMap); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package mastery
+
+import (
+	"fmt"
+	"strings"
+)
+
+var Divisions = []string{"div1", "div2", "div3", "div4", "div1+2", "educational", "global", "other"}
+
+//builds the extra WHERE conditions for a ProblemFilter against problems aliased as p.
+//placeholders are numbered from next so the caller can append the args after its own
+func getProblemFilterSQL(f ProblemFilter, next int) (string, []any) {
+	var conds []string
+	var args []any
+
+	if len(f.Divisions) > 0 || f.SinceYear > 0 {
+		contestConds := []string{"c.contest_id = p.contest_id"}
+		if len(f.Divisions) > 0 {
+			contestConds = append(contestConds, fmt.Sprintf("c.division = ANY($%d::text[])", next))
+			args = append(args, f.Divisions)
+			next++
+		}
+		if f.SinceYear > 0 {
+			contestConds = append(contestConds, fmt.Sprintf("c.start_time >= make_date($%d, 1, 1)", next))
+			args = append(args, f.SinceYear)
+			next++
+		}
+		conds = append(conds, "AND EXISTS (SELECT 1 FROM contests c WHERE "+strings.Join(contestConds, " AND ")+")")
+	}
+
+	if len(f.Indexes) > 0 {
+		conds = append(conds, fmt.Sprintf("AND LEFT(p.problem_index, 1) = ANY($%d::text[])", next))
+		args = append(args, f.Indexes)
+		next++
+	}
+
+	if f.Lang != "" {
+		conds = append(conds, fmt.Sprintf("AND p.lang = $%d", next))
+		args = append(args, f.Lang)
+	}
+
+	return strings.Join(conds, "\n"), args
+}
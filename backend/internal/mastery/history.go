@@ -0,0 +1,141 @@
+package mastery
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/models"
+)
+
+//reconstructs each handle's current mastery per topic as it stood at time at. bins before at's
+//bin are complete and used as stored; at's own bin is rescored from the solves up to at.
+//results are keyed by the handles as given; matching is case-insensitive
+func getMasteryAsOf(conn *pgxpool.Pool, handles []string, at time.Time, tagMap map[string]string, ancestry models.AncestryMap) (map[string]map[string]float64, error) {
+	out := make(map[string]map[string]float64, len(handles))
+	byLower := make(map[string]string, len(handles))
+	lowered := make([]string, len(handles))
+	for i, h := range handles {
+		out[h] = make(map[string]float64)
+		byLower[strings.ToLower(h)] = h
+		lowered[i] = strings.ToLower(h)
+	}
+	if len(handles) == 0 {
+		return out, nil
+	}
+
+	at = at.UTC()
+	atBinIdx := getAbsoluteBinIdx(at)
+	rows, err := conn.Query(context.Background(), `
+		SELECT LOWER(handle), topic_slug, bin_idx, bin_score
+		FROM user_interval_stats
+		WHERE LOWER(handle) = ANY($1) AND bin_idx < $2
+	`, lowered, atBinIdx)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bins := make(map[string]map[string]map[int]float64)
+	setBin := func(handle string, topic string, idx int, score float64) {
+		if bins[handle] == nil {
+			bins[handle] = make(map[string]map[int]float64)
+		}
+		if bins[handle][topic] == nil {
+			bins[handle][topic] = make(map[int]float64)
+		}
+		bins[handle][topic][idx] = score
+	}
+	for rows.Next() {
+		var handle, topic string
+		var idx int
+		var score float64
+		if err := rows.Scan(&handle, &topic, &idx, &score); err != nil {
+			return nil, err
+		}
+		setBin(handle, topic, idx, score)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	binStart := time.Unix(int64(atBinIdx)*int64(N*86400), 0).UTC()
+	solveRows, err := conn.Query(context.Background(), `
+		SELECT LOWER(us.handle), us.problem_id,
+		       COALESCE(p.rating, us.rating),
+		       COALESCE(p.estimated, us.estimated),
+		       COALESCE(p.tags, '{}'),
+		       us.attempts, us.time_spent_minutes, us.solved_at
+		FROM user_solves us
+		LEFT JOIN problems p ON p.problem_id = us.problem_id
+		WHERE LOWER(us.handle) = ANY($1) AND us.solved_at >= $2 AND us.solved_at <= $3
+	`, lowered, binStart, at)
+	if err != nil {
+		return nil, err
+	}
+	defer solveRows.Close()
+
+	partial := make(map[string]map[BinKey]*BinAgg)
+	for solveRows.Next() {
+		var handle string
+		var sub Submission
+		if err := solveRows.Scan(&handle, &sub.ID, &sub.Rating, &sub.Estimated, &sub.TopicSlugs, &sub.Attempts, &sub.TimeSpentMinutes, &sub.SolvedAt); err != nil {
+			return nil, err
+		}
+		if partial[handle] == nil {
+			partial[handle] = make(map[BinKey]*BinAgg)
+		}
+		accumulateSubmission(partial[handle], sub, tagMap, ancestry)
+	}
+	if err := solveRows.Err(); err != nil {
+		return nil, err
+	}
+	for handle, binAgg := range partial {
+		for key, a := range binAgg {
+			setBin(handle, key.Topic, key.BinIdx, calculateIntervalBin(a.Solves))
+		}
+	}
+
+	for handle, topics := range bins {
+		for topic, binMap := range topics {
+			out[byLower[handle]][topic] = calculateMasteryCurrentScore(getTopicScoresArr(atBinIdx, binMap))
+		}
+	}
+	return out, nil
+}
+
+//each topic's share of the rated problemset, used to weight topics into one overall mastery.
+//a problem counts once per topic it maps to, so weights sum to more than 1 across topics
+func getTopicWeights(conn *pgxpool.Pool, tagMap map[string]string) (map[string]float64, error) {
+	rows, err := conn.Query(context.Background(), "SELECT tags FROM problems WHERE NOT estimated")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	total := 0
+	for rows.Next() {
+		var tags []string
+		if err := rows.Scan(&tags); err != nil {
+			return nil, err
+		}
+		//the catalog stores topic slugs, not codeforces tags
+		for _, topic := range tags {
+			counts[topic]++
+		}
+		total++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	weights := make(map[string]float64, len(counts))
+	for topic := range getTopics(tagMap) {
+		if total > 0 {
+			weights[topic] = float64(counts[topic]) / float64(total)
+		}
+	}
+	return weights, nil
+}
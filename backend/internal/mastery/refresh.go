@@ -0,0 +1,256 @@
+package mastery
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/models"
+)
+
+//classifies a contest by its name, e.g. "Codeforces Round 900 (Div. 3)" is div3
+func GetDivision(name string) string {
+	switch {
+	case strings.Contains(name, "Educational"):
+		return "educational"
+	case strings.Contains(name, "Global Round"):
+		return "global"
+	case strings.Contains(name, "Div. 1 + Div. 2"), strings.Contains(name, "Div. 1+2"):
+		return "div1+2"
+	case strings.Contains(name, "Div. 1"):
+		return "div1"
+	case strings.Contains(name, "Div. 2"):
+		return "div2"
+	case strings.Contains(name, "Div. 3"):
+		return "div3"
+	case strings.Contains(name, "Div. 4"):
+		return "div4"
+	}
+	return "other"
+}
+
+//turns problemset.problems output into catalog rows. problems without any mapped topic are dropped,
+//unrated ones get an estimated rating
+func BuildCatalogRows(problems []models.CFProblem, solvedCounts map[string]int, divisions map[int]string, tagMap map[string]string) []CatalogRow {
+	rows := make([]CatalogRow, 0, len(problems))
+	for _, p := range problems {
+		topics := getTopicSlugs(p.Tags, tagMap)
+		if len(topics) == 0 {
+			continue
+		}
+		sort.Strings(topics)
+
+		id := fmt.Sprintf("%d%s", p.ContestID, p.Index)
+
+		//unrated problems get a predicted rating so fresh contests are usable right away
+		rating, estimated := p.Rating, false
+		if rating == 0 {
+			rating = EstimateRating(p.Tags, p.Index, divisions[p.ContestID], solvedCounts[id], tagMap)
+			estimated = true
+		}
+
+		rows = append(rows, CatalogRow{
+			ID: id,
+			Name: p.Name,
+			Rating: rating,
+			Tags: topics,
+			ContestID: p.ContestID,
+			Index: p.Index,
+			Estimated: estimated,
+			Lang: GetProblemLang(p.Name),
+			SolvedCount: solvedCounts[id],
+		})
+	}
+	return rows
+}
+
+//diffs the live problemset against the problems table. new problems are inserted, re-rated or
+//re-tagged ones are updated and logged to problem_changes, and every user who solved a changed
+//problem has their bins rebuilt so mastery doesn't keep the stale credit
+func refreshProblemset(conn *pgxpool.Pool, cf CFClient, tagMap map[string]string, ancestry models.AncestryMap) (RefreshSummary, error) {
+	var summary RefreshSummary
+
+	divisions, err := RefreshContests(conn, cf)
+	if err != nil {
+		return summary, err
+	}
+
+	problems, stats, err := cf.ProblemsetProblems()
+	if err != nil {
+		return summary, fmt.Errorf("failed to fetch problemset: %w", err)
+	}
+	solvedCounts := make(map[string]int, len(stats))
+	for _, st := range stats {
+		solvedCounts[fmt.Sprintf("%d%s", st.ContestID, st.Index)] = st.SolvedCount
+	}
+	catalog := BuildCatalogRows(problems, solvedCounts, divisions, tagMap)
+
+	type stored struct {
+		rating int
+		tags []string
+		estimated bool
+	}
+	existing := make(map[string]stored)
+	rows, err := conn.Query(context.Background(), "SELECT problem_id, rating, tags, estimated FROM problems")
+	if err != nil {
+		return summary, err
+	}
+	for rows.Next() {
+		var id string
+		var st stored
+		if err := rows.Scan(&id, &st.rating, &st.tags, &st.estimated); err != nil {
+			rows.Close()
+			return summary, err
+		}
+		sort.Strings(st.tags)
+		existing[id] = st
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return summary, err
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return summary, err
+	}
+	defer tx.Rollback(context.Background())
+
+	var b pgx.Batch
+	var changed []string
+	for _, p := range catalog {
+		old, ok := existing[p.ID]
+		if !ok {
+			b.Queue(`
+				INSERT INTO problems (problem_id, name, rating, tags, contest_id, problem_index, estimated, lang, solved_count)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			`, p.ID, p.Name, p.Rating, p.Tags, p.ContestID, p.Index, p.Estimated, p.Lang, p.SolvedCount)
+			b.Queue(`
+				INSERT INTO problem_changes (problem_id, change_type, new_rating, new_tags)
+				VALUES ($1, 'new', $2, $3)
+			`, p.ID, p.Rating, p.Tags)
+			summary.Inserted++
+			continue
+		}
+		//a real rating that matches the rounded estimate still has to clear the estimated flag
+		if old.rating == p.Rating && old.estimated == p.Estimated && slices.Equal(old.tags, p.Tags) {
+			continue
+		}
+		b.Queue(`
+			UPDATE problems
+			SET name = $2, rating = $3, tags = $4, estimated = $5, lang = $6
+			WHERE problem_id = $1
+		`, p.ID, p.Name, p.Rating, p.Tags, p.Estimated, p.Lang)
+		b.Queue(`
+			INSERT INTO problem_changes (problem_id, change_type, old_rating, new_rating, old_tags, new_tags)
+			VALUES ($1, 'updated', $2, $3, $4, $5)
+		`, p.ID, old.rating, p.Rating, old.tags, p.Tags)
+		changed = append(changed, p.ID)
+		summary.Updated++
+	}
+
+	if b.Len() > 0 {
+		if err := tx.SendBatch(context.Background(), &b).Close(); err != nil {
+			return summary, err
+		}
+	}
+
+	ids := make([]string, 0, len(solvedCounts))
+	counts := make([]int32, 0, len(solvedCounts))
+	for id, count := range solvedCounts {
+		ids = append(ids, id)
+		counts = append(counts, int32(count))
+	}
+	_, err = tx.Exec(context.Background(), `
+		UPDATE problems p
+		SET solved_count = u.solved_count
+		FROM UNNEST($1::text[], $2::int[]) AS u(problem_id, solved_count)
+		WHERE p.problem_id = u.problem_id AND p.solved_count <> u.solved_count
+	`, ids, counts)
+	if err != nil {
+		return summary, err
+	}
+
+	if err := tx.Commit(context.Background()); err != nil {
+		return summary, err
+	}
+
+	if len(changed) == 0 {
+		return summary, nil
+	}
+
+	handles, err := getHandlesWithSolves(conn, changed)
+	if err != nil {
+		return summary, err
+	}
+	for _, handle := range handles {
+		if err := rebuildUserBins(conn, cf, handle, tagMap, ancestry); err != nil {
+			log.Printf("could not rebuild bins for %s: %v", handle, err)
+			continue
+		}
+		summary.RebuiltUsers++
+	}
+	return summary, nil
+}
+
+//upserts contest.list and returns each contest's division. seeding uses it too
+func RefreshContests(conn *pgxpool.Pool, cf CFClient) (map[int]string, error) {
+	contests, err := cf.ContestList()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch contests: %w", err)
+	}
+
+	divisions := make(map[int]string, len(contests))
+	var b pgx.Batch
+	for _, c := range contests {
+		division := GetDivision(c.Name)
+		divisions[c.ID] = division
+
+		var startTime *time.Time
+		if c.StartTimeSeconds > 0 {
+			t := time.Unix(c.StartTimeSeconds, 0).UTC()
+			startTime = &t
+		}
+		b.Queue(`
+			INSERT INTO contests (contest_id, name, division, type, start_time)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (contest_id) DO UPDATE
+			SET name = EXCLUDED.name,
+			    division = EXCLUDED.division,
+			    type = EXCLUDED.type,
+			    start_time = EXCLUDED.start_time
+		`, c.ID, c.Name, division, c.Type, startTime)
+	}
+	if b.Len() == 0 {
+		return divisions, nil
+	}
+	return divisions, conn.SendBatch(context.Background(), &b).Close()
+}
+
+func getHandlesWithSolves(conn *pgxpool.Pool, problemIDs []string) ([]string, error) {
+	rows, err := conn.Query(context.Background(), `
+		SELECT DISTINCT handle
+		FROM user_problems
+		WHERE status = 'solved' AND problem_id = ANY($1)
+	`, problemIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var handles []string
+	for rows.Next() {
+		var handle string
+		if err := rows.Scan(&handle); err != nil {
+			return nil, err
+		}
+		handles = append(handles, handle)
+	}
+	return handles, rows.Err()
+}
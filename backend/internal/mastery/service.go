@@ -1,6 +1,8 @@
 package mastery
 
 import (
+	"time"
+
 	"github.com/jackc/pgx/v5/pgxpool"
     "github.com/tanaydonde/cf-curriculum-planner/backend/internal/models"
 )
@@ -9,16 +11,22 @@ type MasteryService struct {
     tagMap map[string]string
     ancestry models.AncestryMap
 	conn *pgxpool.Pool
+    cf CFClient
+    standings *standingsCache
 }
 
 func NewMasteryService(conn *pgxpool.Pool) *MasteryService {
+    return NewMasteryServiceWithClient(conn, NewCFClient())
+}
+
+func NewMasteryServiceWithClient(conn *pgxpool.Pool, cf CFClient) *MasteryService {
     nodes, edges := models.GetGraph(conn)
     anc := BuildAncestryMap(nodes, edges)
-    return &MasteryService{tagMap: GetTagMap(), ancestry: anc, conn: conn}
+    return &MasteryService{tagMap: GetTagMap(), ancestry: anc, conn: conn, cf: cf, standings: newStandingsCache()}
 }
 
 func (s *MasteryService) Sync(handle string) error {
-    return syncUser(s.conn, handle, s.tagMap, s.ancestry)
+    return syncUser(s.conn, s.cf, handle, s.tagMap, s.ancestry, false)
 }
 
 func (s *MasteryService) GetAllStats(handle string) (map[string]MasteryResult, error) {
@@ -26,11 +34,11 @@ func (s *MasteryService) GetAllStats(handle string) (map[string]MasteryResult, e
 }
 
 func (s *MasteryService) UpdateSubmission(handle string, problem ProblemSolveInput) error {
-    return updateSubmissionFull(s.conn, handle, problem, s.tagMap, s.ancestry)
+    return updateSubmissionFull(s.conn, s.cf, handle, problem, s.tagMap, s.ancestry)
 }
 
-func (s *MasteryService) RecommendProblem(handle string, topic string, targetInc int, k int) ([]CFProblemOutput, error) {
-    return recommendProblem(s.conn, handle, topic, targetInc, k)
+func (s *MasteryService) RecommendProblem(handle string, topics []string, opts RecommendOptions) ([]CFProblemOutput, error) {
+    return recommendProblem(s.conn, handle, topics, opts)
 }
 
 func (s* MasteryService) RecommendDailyProblem(handle string) (CFProblemOutput, error) {
@@ -39,4 +47,79 @@ func (s* MasteryService) RecommendDailyProblem(handle string) (CFProblemOutput,
 
 func (s* MasteryService) GetLastKSolves(handle string, k int, status string) ([]CFSolveOutput, error) {
     return getLastKSolves(s.conn, handle, k, status)
-}
\ No newline at end of file
+}
+
+func (s* MasteryService) GetUpsolveQueue(handle string, k int) ([]UpsolveOutput, error) {
+    return getUpsolveQueue(s.conn, s.cf, s.standings, handle, s.tagMap, k)
+}
+
+func (s* MasteryService) SearchProblems(q CatalogQuery) ([]CatalogProblem, string, error) {
+    return searchProblems(s.conn, q)
+}
+
+func (s* MasteryService) RefreshProblemset() (RefreshSummary, error) {
+    return refreshProblemset(s.conn, s.cf, s.tagMap, s.ancestry)
+}
+
+func (s* MasteryService) RebuildUserBins(handle string) error {
+    return rebuildUserBins(s.conn, s.cf, handle, s.tagMap, s.ancestry)
+}
+
+func (s* MasteryService) ListSolves(handle string) ([]SolveEvent, error) {
+    return listSolves(s.conn, handle)
+}
+
+func (s* MasteryService) DeleteSolve(handle string, problemID string) error {
+    return deleteSolve(s.conn, s.cf, handle, problemID, s.tagMap, s.ancestry)
+}
+
+func (s* MasteryService) GetVerdictStats(handle string) ([]TopicVerdicts, error) {
+    return getVerdictStats(s.conn, handle)
+}
+func (s* MasteryService) GetMasteryAsOf(handles []string, at time.Time) (map[string]map[string]float64, error) {
+    return getMasteryAsOf(s.conn, handles, at, s.tagMap, s.ancestry)
+}
+
+func (s* MasteryService) GetTopicWeights() (map[string]float64, error) {
+    return getTopicWeights(s.conn, s.tagMap)
+}
+
+func (s* MasteryService) CompareHandles(handles []string, limit int) (Comparison, error) {
+    return compareHandles(s.conn, handles, limit, s.tagMap)
+}
+
+func (s* MasteryService) GetProblemTopics(problemIDs []string) ([]string, []string, error) {
+    return getProblemTopics(s.conn, problemIDs)
+}
+
+func (s* MasteryService) CreateVirtualContest(handle string, opts VirtualContestOptions) (VirtualContest, error) {
+    return createVirtualContest(s.conn, handle, opts, s.tagMap)
+}
+
+func (s* MasteryService) ListVirtualContests(handle string) ([]VirtualContest, error) {
+    return listVirtualContests(s.conn, handle)
+}
+
+func (s* MasteryService) GetVirtualContest(handle string, id int) (VirtualContest, error) {
+    return getVirtualContest(s.conn, handle, id)
+}
+
+func (s* MasteryService) StartSession(handle string, problemID string) (SolveSession, error) {
+    return startSession(s.conn, handle, problemID)
+}
+
+func (s* MasteryService) PauseSession(handle string, id int) (SolveSession, error) {
+    return pauseSession(s.conn, handle, id)
+}
+
+func (s* MasteryService) ResumeSession(handle string, id int) (SolveSession, error) {
+    return resumeSession(s.conn, handle, id)
+}
+
+func (s* MasteryService) CancelSession(handle string, id int) error {
+    return cancelSession(s.conn, handle, id)
+}
+
+func (s* MasteryService) ListSessions(handle string) ([]SolveSession, error) {
+    return listSessions(s.conn, handle)
+}
@@ -0,0 +1,191 @@
+package mastery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//sessions left running past this are capped, so a forgotten timer can't zero out the speed bonus
+const sessionCapMinutes = 240
+
+var (
+	ErrSessionNotFound = errors.New("no active session with that id")
+	ErrAlreadySolved = errors.New("problem is already solved")
+)
+
+//starts timing a problem. starting it again while a session is active returns that session
+func startSession(conn *pgxpool.Pool, handle string, problemID string) (SolveSession, error) {
+	var solved bool
+	err := conn.QueryRow(context.Background(), `
+		SELECT EXISTS (SELECT 1 FROM user_problems WHERE handle = $1 AND problem_id = $2 AND status = 'solved')
+	`, handle, problemID).Scan(&solved)
+	if err != nil {
+		return SolveSession{}, err
+	}
+	if solved {
+		return SolveSession{}, ErrAlreadySolved
+	}
+
+	_, err = conn.Exec(context.Background(), `
+		INSERT INTO solve_sessions (handle, problem_id, started_at) VALUES ($1, $2, $3)
+		ON CONFLICT (handle, problem_id) WHERE status = 'active' DO NOTHING
+	`, handle, problemID, time.Now().UTC())
+	if err != nil {
+		return SolveSession{}, err
+	}
+
+	sessions, err := loadSessions(conn, handle, "AND problem_id = $2 AND status = 'active'", problemID)
+	if err != nil {
+		return SolveSession{}, err
+	}
+	if len(sessions) == 0 {
+		return SolveSession{}, ErrSessionNotFound
+	}
+	return sessions[0], nil
+}
+
+func pauseSession(conn *pgxpool.Pool, handle string, id int) (SolveSession, error) {
+	return updateSession(conn, handle, id, `
+		UPDATE solve_sessions SET paused_at = $3
+		WHERE handle = $1 AND id = $2 AND status = 'active' AND paused_at IS NULL
+	`)
+}
+
+func resumeSession(conn *pgxpool.Pool, handle string, id int) (SolveSession, error) {
+	return updateSession(conn, handle, id, `
+		UPDATE solve_sessions
+		SET paused_seconds = paused_seconds + CAST(EXTRACT(EPOCH FROM ($3::timestamp - paused_at)) AS INT), paused_at = NULL
+		WHERE handle = $1 AND id = $2 AND status = 'active' AND paused_at IS NOT NULL
+	`)
+}
+
+//pausing a paused session or resuming a running one leaves it unchanged
+func updateSession(conn *pgxpool.Pool, handle string, id int, query string) (SolveSession, error) {
+	if _, err := conn.Exec(context.Background(), query, handle, id, time.Now().UTC()); err != nil {
+		return SolveSession{}, err
+	}
+	sessions, err := loadSessions(conn, handle, "AND id = $2 AND status = 'active'", id)
+	if err != nil {
+		return SolveSession{}, err
+	}
+	if len(sessions) == 0 {
+		return SolveSession{}, ErrSessionNotFound
+	}
+	return sessions[0], nil
+}
+
+func cancelSession(conn *pgxpool.Pool, handle string, id int) error {
+	tag, err := conn.Exec(context.Background(), `
+		DELETE FROM solve_sessions WHERE handle = $1 AND id = $2 AND status = 'active'
+	`, handle, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func listSessions(conn *pgxpool.Pool, handle string) ([]SolveSession, error) {
+	return loadSessions(conn, handle, "")
+}
+
+//cond is appended to the WHERE clause after handle = $1, with its args from $2
+func loadSessions(q queryer, handle string, cond string, args ...any) ([]SolveSession, error) {
+	rows, err := q.Query(context.Background(), `
+		SELECT id, handle, problem_id, started_at, paused_at, paused_seconds, status, completed_at, minutes
+		FROM solve_sessions
+		WHERE handle = $1 `+cond+`
+		ORDER BY started_at DESC
+	`, append([]any{handle}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []SolveSession{}
+	for rows.Next() {
+		var ss SolveSession
+		if err := rows.Scan(&ss.ID, &ss.Handle, &ss.ProblemID, &ss.StartedAt, &ss.PausedAt, &ss.PausedSeconds,
+			&ss.Status, &ss.CompletedAt, &ss.Minutes); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, ss)
+	}
+	return sessions, rows.Err()
+}
+
+//closes every active session whose problem now has an accepted submission after the session
+//started, and returns the timed minutes for each completed session's problem
+func completeSessions(tx pgx.Tx, handle string, submissions []CFSubmission) (map[string]int, error) {
+	sessions, err := loadSessions(tx, handle, "")
+	if err != nil {
+		return nil, err
+	}
+
+	minutes := make(map[string]int)
+	var b pgx.Batch
+	for _, ss := range sessions {
+		if ss.Status == "completed" {
+			if ss.Minutes != nil {
+				minutes[ss.ProblemID] = *ss.Minutes
+			}
+			continue
+		}
+
+		okAt := firstAcceptedAfter(ss.ProblemID, ss.StartedAt, submissions)
+		if okAt == nil {
+			continue
+		}
+		m := sessionMinutes(ss, *okAt)
+		minutes[ss.ProblemID] = m
+		b.Queue(`
+			UPDATE solve_sessions
+			SET status = 'completed', completed_at = $2, minutes = $3, paused_at = NULL
+			WHERE id = $1
+		`, ss.ID, *okAt, m)
+	}
+
+	if b.Len() > 0 {
+		if err := tx.SendBatch(context.Background(), &b).Close(); err != nil {
+			return nil, err
+		}
+	}
+	return minutes, nil
+}
+
+func firstAcceptedAfter(problemID string, start time.Time, submissions []CFSubmission) *time.Time {
+	var accepted []time.Time
+	for _, s := range submissions {
+		if s.Verdict != "OK" || fmt.Sprintf("%d%s", s.Problem.ContestID, s.Problem.Index) != problemID {
+			continue
+		}
+		if t := time.Unix(s.CreationTimeSeconds, 0).UTC(); !t.Before(start) {
+			accepted = append(accepted, t)
+		}
+	}
+	if len(accepted) == 0 {
+		return nil
+	}
+	sort.Slice(accepted, func(i, j int) bool { return accepted[i].Before(accepted[j]) })
+	return &accepted[0]
+}
+
+//wall time from start to the accepted submission minus pauses. a pause still open at okAt
+//only counts up to okAt
+func sessionMinutes(ss SolveSession, okAt time.Time) int {
+	elapsed := okAt.Sub(ss.StartedAt) - time.Duration(ss.PausedSeconds)*time.Second
+	if ss.PausedAt != nil && ss.PausedAt.Before(okAt) {
+		elapsed -= okAt.Sub(*ss.PausedAt)
+	}
+	m := int(math.Ceil(elapsed.Minutes()))
+	return min(max(m, 1), sessionCapMinutes)
+}
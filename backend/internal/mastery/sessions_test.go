@@ -0,0 +1,41 @@
+package mastery
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionMinutes(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes float64) *time.Time {
+		t := start.Add(time.Duration(minutes * float64(time.Minute)))
+		return &t
+	}
+
+	tests := []struct {
+		name string
+		pausedAt *time.Time
+		pausedSeconds int
+		okAt time.Time
+		want int
+	}{
+		{"plain wall time", nil, 0, *at(25), 25},
+		{"partial minutes round up", nil, 0, *at(25.2), 26},
+		{"instant accept counts one minute", nil, 0, start, 1},
+		{"finished pauses are subtracted", nil, 10 * 60, *at(40), 30},
+		{"open pause counts up to the accept", at(30), 0, *at(50), 30},
+		{"open and finished pauses add up", at(30), 5 * 60, *at(50), 25},
+		{"pause opened after the accept is ignored", at(60), 0, *at(50), 50},
+		{"pauses longer than the session floor at one", nil, 60 * 60, *at(20), 1},
+		{"capped like a long session", nil, 0, *at(600), sessionCapMinutes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss := SolveSession{StartedAt: start, PausedAt: tt.pausedAt, PausedSeconds: tt.pausedSeconds}
+			if got := sessionMinutes(ss, tt.okAt); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
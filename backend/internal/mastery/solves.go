@@ -0,0 +1,363 @@
+package mastery
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/models"
+)
+
+var ErrSolveNotFound = errors.New("solve not found")
+
+//records one event per solve; bins are always derived from these rows.
+//a sync never overwrites a manual or imported event, whose time spent it doesn't know about
+func bulkUpsertUserSolves(tx pgx.Tx, handle string, solves []Submission) error {
+	if len(solves) == 0 {
+		return nil
+	}
+	var b pgx.Batch
+	for _, sub := range solves {
+		b.Queue(`
+			INSERT INTO user_solves (handle, problem_id, rating, estimated, attempts, time_spent_minutes, solved_at, source)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (handle, problem_id) DO UPDATE SET
+				rating = EXCLUDED.rating,
+				estimated = EXCLUDED.estimated,
+				attempts = EXCLUDED.attempts,
+				time_spent_minutes = EXCLUDED.time_spent_minutes,
+				solved_at = EXCLUDED.solved_at,
+				source = EXCLUDED.source
+			WHERE EXCLUDED.source <> 'sync' OR user_solves.source = 'sync'
+		`, handle, sub.ID, sub.Rating, sub.Estimated, sub.Attempts, sub.TimeSpentMinutes, sub.SolvedAt.UTC(), sub.Source)
+	}
+	return tx.SendBatch(context.Background(), &b).Close()
+}
+
+//true when user_problems has solves with no event behind them
+func hasMissingSolves(conn *pgxpool.Pool, handle string) (bool, error) {
+	var missing bool
+	err := conn.QueryRow(context.Background(), `
+		SELECT EXISTS (
+			SELECT 1
+			FROM user_problems up
+			WHERE up.handle = $1 AND up.status = 'solved'
+			AND NOT EXISTS (
+				SELECT 1 FROM user_solves us
+				WHERE us.handle = up.handle AND us.problem_id = up.problem_id
+			)
+		)
+	`, handle).Scan(&missing)
+	return missing, err
+}
+
+//solved rows codeforces no longer backs with an accepted run (e.g. rejudged to skipped) carry no
+//credit. they go back to unsolved, otherwise hasMissingSolves would force a full sync every time
+func demoteUnbackedSolves(tx pgx.Tx, handle string) error {
+	_, err := tx.Exec(context.Background(), `
+		UPDATE user_problems up
+		SET status = 'unsolved', solved_at = NULL
+		WHERE up.handle = $1 AND up.status = 'solved'
+		AND NOT EXISTS (
+			SELECT 1 FROM user_solves us
+			WHERE us.handle = up.handle AND us.problem_id = up.problem_id
+		)
+	`, handle)
+	return err
+}
+
+//recovers the time spent on solves that were logged manually before user_solves existed. the
+//legacy bins kept every credit as base rating and multiplier, so a solve whose legacy base isn't
+//its untimed base was given a time, and the speed multiplier between the two gives it back.
+//returns minutes by problem id for the solves sync has no time for
+func recoverLegacyMinutes(tx pgx.Tx, handle string, solves []Submission, tagMap map[string]string, ancestry models.AncestryMap) (map[string]int, error) {
+	rows, err := tx.Query(context.Background(), `
+		SELECT topic_slug, bin_idx, credits, multipliers
+		FROM user_interval_stats
+		WHERE handle = $1 AND CARDINALITY(credits) > 0
+	`, handle)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	legacy := make(map[BinKey][]SolveAttributes)
+	for rows.Next() {
+		var key BinKey
+		var credits, multipliers []float64
+		if err := rows.Scan(&key.Topic, &key.BinIdx, &credits, &multipliers); err != nil {
+			return nil, err
+		}
+		for i := range min(len(credits), len(multipliers)) {
+			if multipliers[i] > 0 {
+				legacy[key] = append(legacy[key], SolveAttributes{BaseRating: credits[i] / multipliers[i], Multiplier: multipliers[i]})
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return matchLegacyMinutes(legacy, solves, tagMap, ancestry), nil
+}
+
+//matches the legacy credits, by bin, to the solves that produced them and turns the timed ones
+//back into minutes. claimed credits are removed from legacy
+func matchLegacyMinutes(legacy map[BinKey][]SolveAttributes, solves []Submission, tagMap map[string]string, ancestry models.AncestryMap) map[string]int {
+	minutes := make(map[string]int)
+	if len(legacy) == 0 {
+		return minutes
+	}
+
+	//takes the legacy credit in a bin that matches m and satisfies ok, preferring a base closest to want
+	claim := func(key BinKey, m float64, want float64, ok func(base float64) bool) (float64, bool) {
+		best := -1
+		for i, a := range legacy[key] {
+			if math.Abs(a.Multiplier-m) > 1e-9 || !ok(a.BaseRating) {
+				continue
+			}
+			if best == -1 || math.Abs(a.BaseRating-want) < math.Abs(legacy[key][best].BaseRating-want) {
+				best = i
+			}
+		}
+		if best == -1 {
+			return 0, false
+		}
+		base := legacy[key][best].BaseRating
+		legacy[key] = append(legacy[key][:best], legacy[key][best+1:]...)
+		return base, true
+	}
+
+	//first every untimed credit is matched to its solve in every topic, so only timed credits remain
+	var timed []int
+	for i, sub := range solves {
+		//the legacy code had no estimates, so unrated solves carried no credit
+		if sub.Estimated || sub.Rating == 0 {
+			continue
+		}
+		untimed := getBaseRating(sub.Rating, sub.Attempts)
+		binIdx := getAbsoluteBinIdx(sub.SolvedAt)
+		matched := false
+		for topic := range getTopics(tagMap) {
+			m := getMultiplier(topic, sub, ancestry)
+			if m <= 0 {
+				continue
+			}
+			if _, ok := claim(BinKey{Topic: topic, BinIdx: binIdx}, m, untimed, func(base float64) bool {
+				return math.Abs(base-untimed) < 1e-6
+			}); ok {
+				matched = true
+			}
+		}
+		if !matched && sub.TimeSpentMinutes == 0 && len(sub.TopicSlugs) > 0 {
+			timed = append(timed, i)
+		}
+	}
+
+	//an instant solve gets the largest speed multiplier, so anything above it isn't a timed credit
+	maxSpeed := speedFloor + (1-speedFloor)*float64(speedAvgMinutes+speedSmoothing)/speedSmoothing
+	for _, i := range timed {
+		sub := solves[i]
+		untimed := getBaseRating(sub.Rating, sub.Attempts)
+		key := BinKey{Topic: sub.TopicSlugs[0], BinIdx: getAbsoluteBinIdx(sub.SolvedAt)}
+		base, ok := claim(key, getMultiplier(key.Topic, sub, ancestry), untimed, func(base float64) bool {
+			speed := base / untimed
+			return speed > speedFloor && speed <= maxSpeed
+		})
+		if ok {
+			minutes[sub.ID] = getMinutesForSpeed(base / untimed)
+		}
+	}
+	return minutes
+}
+
+//recomputes bin scores from user_solves. binIdxs limits the work to those bins, nil rebuilds all of them
+func rebuildBins(tx pgx.Tx, handle string, binIdxs []int, tagMap map[string]string, ancestry models.AncestryMap) error {
+	if binIdxs != nil && len(binIdxs) == 0 {
+		return nil
+	}
+
+	solves, err := loadUserSolves(tx, handle, binIdxs)
+	if err != nil {
+		return err
+	}
+
+	binAgg := make(map[BinKey]*BinAgg)
+	for _, sub := range solves {
+		accumulateSubmission(binAgg, sub, tagMap, ancestry)
+	}
+
+	if binIdxs == nil {
+		_, err = tx.Exec(context.Background(), "DELETE FROM user_interval_stats WHERE handle = $1", handle)
+	} else {
+		_, err = tx.Exec(context.Background(), "DELETE FROM user_interval_stats WHERE handle = $1 AND bin_idx = ANY($2)", handle, binIdxs)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(binAgg) == 0 {
+		return nil
+	}
+	var b pgx.Batch
+	for key, a := range binAgg {
+		b.Queue(`
+			INSERT INTO user_interval_stats (handle, topic_slug, bin_idx, bin_score, last_updated)
+			VALUES ($1, $2, $3, $4, NOW())
+		`, handle, key.Topic, key.BinIdx, calculateIntervalBin(a.Solves))
+	}
+	return tx.SendBatch(context.Background(), &b).Close()
+}
+
+//loads a handle's solves with rating and topics taken from the current catalog when available.
+//binIdxs restricts to solves falling in those bins, nil loads everything
+func loadUserSolves(tx pgx.Tx, handle string, binIdxs []int) ([]Submission, error) {
+	rows, err := tx.Query(context.Background(), `
+		SELECT us.problem_id,
+		       COALESCE(p.rating, us.rating),
+		       COALESCE(p.estimated, us.estimated),
+		       COALESCE(p.tags, '{}'),
+		       us.attempts, us.time_spent_minutes, us.solved_at, us.source
+		FROM user_solves us
+		LEFT JOIN problems p ON p.problem_id = us.problem_id
+		WHERE us.handle = $1
+		AND ($2::int[] IS NULL OR FLOOR(EXTRACT(EPOCH FROM us.solved_at) / $3)::int = ANY($2))
+	`, handle, binIdxs, N*86400)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var solves []Submission
+	for rows.Next() {
+		var sub Submission
+		if err := rows.Scan(&sub.ID, &sub.Rating, &sub.Estimated, &sub.TopicSlugs, &sub.Attempts, &sub.TimeSpentMinutes, &sub.SolvedAt, &sub.Source); err != nil {
+			return nil, err
+		}
+		solves = append(solves, sub)
+	}
+	return solves, rows.Err()
+}
+
+//regenerates every bin for a handle from user_solves using the catalog's current rating and tags
+func rebuildUserBins(conn *pgxpool.Pool, cf CFClient, handle string, tagMap map[string]string, ancestry models.AncestryMap) error {
+	missing, err := hasMissingSolves(conn, handle)
+	if err != nil {
+		return err
+	}
+	if missing {
+		return syncUser(conn, cf, handle, tagMap, ancestry, true)
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	if err := rebuildBins(tx, handle, nil, tagMap, ancestry); err != nil {
+		return err
+	}
+
+	//events now reflect the rating the new credits were computed from
+	_, err = tx.Exec(context.Background(), `
+		UPDATE user_solves us
+		SET rating = p.rating, estimated = p.estimated
+		FROM problems p
+		WHERE us.handle = $1 AND p.problem_id = us.problem_id
+		AND (us.rating <> p.rating OR us.estimated <> p.estimated)
+	`, handle)
+	if err != nil {
+		return err
+	}
+
+	topics, err := loadAllTopicBins(tx, handle, tagMap)
+	if err != nil {
+		return err
+	}
+	if err := fillAllTopicMasteryBatch(tx, handle, getAbsoluteBinIdx(time.Now()), topics); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
+
+func listSolves(conn *pgxpool.Pool, handle string) ([]SolveEvent, error) {
+	rows, err := conn.Query(context.Background(), `
+		SELECT us.problem_id, COALESCE(p.name, ''), us.rating, us.estimated,
+		       us.attempts, us.time_spent_minutes, us.solved_at, us.source
+		FROM user_solves us
+		LEFT JOIN problems p ON p.problem_id = us.problem_id
+		WHERE us.handle = $1
+		ORDER BY us.solved_at DESC
+	`, handle)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []SolveEvent{}
+	for rows.Next() {
+		var e SolveEvent
+		if err := rows.Scan(&e.ProblemID, &e.Name, &e.Rating, &e.Estimated, &e.Attempts, &e.TimeSpentMinutes, &e.SolvedAt, &e.Source); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+//removes a solve event, marks the problem excluded so sync doesn't re-add it,
+//and rebuilds the bin it sat in along with current and peak mastery
+func deleteSolve(conn *pgxpool.Pool, cf CFClient, handle string, problemID string, tagMap map[string]string, ancestry models.AncestryMap) error {
+	missing, err := hasMissingSolves(conn, handle)
+	if err != nil {
+		return err
+	}
+	if missing {
+		if err := syncUser(conn, cf, handle, tagMap, ancestry, true); err != nil {
+			return err
+		}
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(context.Background())
+
+	var solvedAt time.Time
+	err = tx.QueryRow(context.Background(), `
+		DELETE FROM user_solves
+		WHERE handle = $1 AND problem_id = $2
+		RETURNING solved_at
+	`, handle, problemID).Scan(&solvedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrSolveNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(context.Background(), `
+		UPDATE user_problems SET status = 'excluded'
+		WHERE handle = $1 AND problem_id = $2
+	`, handle, problemID)
+	if err != nil {
+		return err
+	}
+
+	if err := rebuildBins(tx, handle, []int{getAbsoluteBinIdx(solvedAt)}, tagMap, ancestry); err != nil {
+		return err
+	}
+
+	topics, err := loadAllTopicBins(tx, handle, tagMap)
+	if err != nil {
+		return err
+	}
+	if err := fillAllTopicMasteryBatch(tx, handle, getAbsoluteBinIdx(time.Now()), topics); err != nil {
+		return err
+	}
+	return tx.Commit(context.Background())
+}
@@ -0,0 +1,102 @@
+package mastery
+
+import (
+	"maps"
+	"testing"
+	"time"
+
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/models"
+)
+
+func TestMatchLegacyMinutes(t *testing.T) {
+	tagMap := GetTagMap()
+	ancestry := models.AncestryMap{
+		"greedy": {"greedy": 0},
+		"math": {"math": 0},
+	}
+	at := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	bin := getAbsoluteBinIdx(at)
+
+	solve := func(id string, rating int, topic string) Submission {
+		return Submission{ID: id, Rating: rating, Attempts: 1, TopicSlugs: []string{topic}, SolvedAt: at}
+	}
+	credit := func(base float64) SolveAttributes {
+		return SolveAttributes{BaseRating: base, Multiplier: 1}
+	}
+	untimed := func(rating int) SolveAttributes {
+		return credit(getBaseRating(rating, 1))
+	}
+	timed := func(rating int, minutes int) SolveAttributes {
+		return credit(getBaseRatingTime(rating, 1, minutes))
+	}
+	estimated := solve("1A", 1500, "greedy")
+	estimated.Estimated = true
+	synced := solve("1A", 1500, "greedy")
+	synced.TimeSpentMinutes = 12
+
+	tests := []struct {
+		name string
+		legacy map[BinKey][]SolveAttributes
+		solves []Submission
+		want map[string]int
+	}{
+		{
+			"untimed credit gives no minutes",
+			map[BinKey][]SolveAttributes{{"greedy", bin}: {untimed(1500)}},
+			[]Submission{solve("1A", 1500, "greedy")},
+			map[string]int{},
+		},
+		{
+			"timed credit gives its minutes back",
+			map[BinKey][]SolveAttributes{{"greedy", bin}: {timed(1500, 30)}},
+			[]Submission{solve("1A", 1500, "greedy")},
+			map[string]int{"1A": 30},
+		},
+		{
+			"untimed credits are claimed before timed ones",
+			map[BinKey][]SolveAttributes{{"greedy", bin}: {timed(1500, 90), untimed(1500)}},
+			[]Submission{solve("1A", 1500, "greedy"), solve("2A", 1500, "greedy")},
+			map[string]int{"2A": 90},
+		},
+		{
+			"credit in another bin is ignored",
+			map[BinKey][]SolveAttributes{{"greedy", bin - 1}: {timed(1500, 30)}},
+			[]Submission{solve("1A", 1500, "greedy")},
+			map[string]int{},
+		},
+		{
+			"credit in another topic is ignored",
+			map[BinKey][]SolveAttributes{{"math", bin}: {timed(1500, 30)}},
+			[]Submission{solve("1A", 1500, "greedy")},
+			map[string]int{},
+		},
+		{
+			"estimated solves had no legacy credit",
+			map[BinKey][]SolveAttributes{{"greedy", bin}: {timed(1500, 30)}},
+			[]Submission{estimated},
+			map[string]int{},
+		},
+		{
+			"solves sync already timed keep their time",
+			map[BinKey][]SolveAttributes{{"greedy", bin}: {timed(1500, 30)}},
+			[]Submission{synced},
+			map[string]int{},
+		},
+		{
+			"credit faster than an instant solve is not a timed credit",
+			map[BinKey][]SolveAttributes{{"greedy", bin}: {credit(getBaseRating(1500, 1) * 2)}},
+			[]Submission{solve("1A", 1500, "greedy")},
+			map[string]int{},
+		},
+		{"no legacy credits", nil, []Submission{solve("1A", 1500, "greedy")}, map[string]int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := matchLegacyMinutes(tt.legacy, tt.solves, tagMap, ancestry)
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
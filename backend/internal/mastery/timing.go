@@ -0,0 +1,125 @@
+package mastery
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+//codeforces reports this relative time for submissions made outside any contest
+const practiceRelativeTime = math.MaxInt32
+
+//server-side timing sources for a handle's solves, keyed by problem id
+type solveTimings struct {
+	virtual map[string]int //minutes since the previous solve in a virtual contest
+	sessions map[string]int //minutes of a completed solve session
+	contest map[contestRun]int //minutes since the previous solve while taking part in a real contest
+}
+
+//one accepted run, since a problem can be accepted both in and after a contest
+type contestRun struct {
+	problem string
+	sentAt int64
+}
+
+//scores running virtual contests and closes finished solve sessions on the way, so sync and
+//manual submit see the same times
+func loadSolveTimings(tx pgx.Tx, handle string, submissions []CFSubmission) (solveTimings, error) {
+	virtual, err := scoreVirtualContests(tx, handle, submissions)
+	if err != nil {
+		return solveTimings{}, err
+	}
+	sessions, err := completeSessions(tx, handle, submissions)
+	if err != nil {
+		return solveTimings{}, err
+	}
+	return solveTimings{virtual: virtual, sessions: sessions, contest: contestTimings(submissions)}, nil
+}
+
+//minutes spent on a solve: a virtual contest, then a solve session, then the real contest the
+//accepted run was sent in. 0 means untimed, which credits on attempts alone
+func (t solveTimings) minutes(id string, accepted CFSubmission) int {
+	if m := t.virtual[id]; m > 0 {
+		return m
+	}
+	if m := t.sessions[id]; m > 0 {
+		return m
+	}
+	return t.contest[contestRun{problem: id, sentAt: accepted.CreationTimeSeconds}]
+}
+
+//times every problem accepted during a contest participation by the gap since the previous
+//accepted problem (or the start for the first), so later problems aren't charged for earlier ones
+func contestTimings(submissions []CFSubmission) map[contestRun]int {
+	type participation struct {
+		contestID int
+		participantType string
+		start int64
+	}
+	accepted := make(map[participation][]CFSubmission)
+	for _, s := range submissions {
+		if s.Verdict != "OK" || !inContest(s) {
+			continue
+		}
+		p := participation{s.Problem.ContestID, s.Author.ParticipantType, s.Author.StartTimeSeconds}
+		accepted[p] = append(accepted[p], s)
+	}
+
+	out := make(map[contestRun]int)
+	for p, runs := range accepted {
+		sort.Slice(runs, func(i, j int) bool { return runs[i].CreationTimeSeconds < runs[j].CreationTimeSeconds })
+		prev := time.Unix(p.start, 0)
+		seen := make(map[string]bool)
+		for _, s := range runs {
+			id := fmt.Sprintf("%d%s", s.Problem.ContestID, s.Problem.Index)
+			//a resubmit of an accepted problem isn't a new solve
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			sentAt := time.Unix(s.CreationTimeSeconds, 0)
+			out[contestRun{problem: id, sentAt: s.CreationTimeSeconds}] = gapMinutes(prev, sentAt)
+			prev = sentAt
+		}
+	}
+	return out
+}
+
+//runs sent while taking part in the contest, as opposed to practice after it
+func inContest(s CFSubmission) bool {
+	switch s.Author.ParticipantType {
+	case "CONTESTANT", "VIRTUAL", "OUT_OF_COMPETITION":
+	default:
+		return false
+	}
+	return s.RelativeTimeSeconds > 0 && s.RelativeTimeSeconds < practiceRelativeTime
+}
+
+//whole minutes between two moments, capped like a solve session
+func gapMinutes(from time.Time, to time.Time) int {
+	return min(max(1, int(math.Ceil(to.Sub(from).Minutes()))), sessionCapMinutes)
+}
+
+//the one place a solve event is built from codeforces data, so sync and manual submit credit
+//the same solve identically. estimated supplies ratings for problems codeforces hasn't rated
+func newSolve(id string, summary AttemptSummary, minutes int, estimated map[string]int, tagMap map[string]string) Submission {
+	accepted := summary.FirstOK
+	sub := Submission{
+		ID: id,
+		Rating: accepted.Problem.Rating,
+		Attempts: summary.Attempts,
+		TopicSlugs: getTopicSlugs(accepted.Problem.Tags, tagMap),
+		TimeSpentMinutes: minutes,
+		SolvedAt: time.Unix(accepted.CreationTimeSeconds, 0).UTC(),
+		FirstAttemptAt: summary.FirstAttemptAt,
+		Verdicts: summary.Verdicts,
+	}
+	if rating, ok := estimated[id]; ok && sub.Rating == 0 {
+		sub.Rating = rating
+		sub.Estimated = true
+	}
+	return sub
+}
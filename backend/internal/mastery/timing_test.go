@@ -0,0 +1,99 @@
+package mastery
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/tanaydonde/cf-curriculum-planner/backend/internal/models"
+)
+
+func TestContestTimings(t *testing.T) {
+	const start = 1_700_000_000
+	//a run sent sec seconds into a participation that began at begin
+	run := func(index string, verdict string, participant string, begin int64, sec int64) CFSubmission {
+		return CFSubmission{
+			Verdict: verdict,
+			Problem: models.CFProblem{ContestID: 1900, Index: index},
+			CreationTimeSeconds: begin + sec,
+			RelativeTimeSeconds: sec,
+			Author: CFSubmissionAuthor{ParticipantType: participant, StartTimeSeconds: begin},
+		}
+	}
+	practice := run("A", "OK", "PRACTICE", start, 600)
+	practice.RelativeTimeSeconds = practiceRelativeTime
+
+	tests := []struct {
+		name string
+		submissions []CFSubmission
+		want map[contestRun]int
+	}{
+		{
+			"each solve is timed from the previous one",
+			[]CFSubmission{
+				run("C", "OK", "CONTESTANT", start, 70*60),
+				run("B", "OK", "CONTESTANT", start, 25*60),
+				run("A", "OK", "CONTESTANT", start, 10*60),
+			},
+			map[contestRun]int{
+				{"1900A", start + 10*60}: 10,
+				{"1900B", start + 25*60}: 15,
+				{"1900C", start + 70*60}: 45,
+			},
+		},
+		{
+			"rejected runs don't restart the clock",
+			[]CFSubmission{
+				run("A", "OK", "CONTESTANT", start, 10*60),
+				run("B", "WRONG_ANSWER", "CONTESTANT", start, 20*60),
+				run("B", "OK", "CONTESTANT", start, 30*60),
+			},
+			map[contestRun]int{
+				{"1900A", start + 10*60}: 10,
+				{"1900B", start + 30*60}: 20,
+			},
+		},
+		{
+			"a resubmitted accept is not a new solve",
+			[]CFSubmission{
+				run("A", "OK", "CONTESTANT", start, 10*60),
+				run("A", "OK", "CONTESTANT", start, 40*60),
+				run("B", "OK", "CONTESTANT", start, 50*60),
+			},
+			map[contestRun]int{
+				{"1900A", start + 10*60}: 10,
+				{"1900B", start + 50*60}: 40,
+			},
+		},
+		{
+			"partial minutes round up",
+			[]CFSubmission{run("A", "OK", "CONTESTANT", start, 10*60+1)},
+			map[contestRun]int{{"1900A", start + 10*60 + 1}: 11},
+		},
+		{
+			"gaps are capped like sessions",
+			[]CFSubmission{run("A", "OK", "VIRTUAL", start, 300*60)},
+			map[contestRun]int{{"1900A", start + 300*60}: sessionCapMinutes},
+		},
+		{
+			"participations are timed separately",
+			[]CFSubmission{
+				run("A", "OK", "CONTESTANT", start, 10*60),
+				run("B", "OK", "VIRTUAL", start+86400, 5*60),
+			},
+			map[contestRun]int{
+				{"1900A", start + 10*60}: 10,
+				{"1900B", start + 86400 + 5*60}: 5,
+			},
+		},
+		{"practice runs are untimed", []CFSubmission{practice}, map[contestRun]int{}},
+		{"no submissions", nil, map[contestRun]int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := contestTimings(tt.submissions); !maps.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
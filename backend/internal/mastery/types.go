@@ -17,6 +17,18 @@ type Submission struct {
 	TopicSlugs []string
 	TimeSpentMinutes int
 	SolvedAt time.Time
+	Estimated bool //rating came from EstimateRating rather than codeforces
+	Source string //sync, manual or import
+	FirstAttemptAt *time.Time
+	Verdicts map[string]int
+	ReportedMinutes int //what the user entered on a manual submit, kept even when a server timing is credited
+}
+
+type AttemptSummary struct {
+	FirstOK *CFSubmission
+	Attempts int
+	FirstAttemptAt *time.Time //nil when nothing was judged
+	Verdicts map[string]int
 }
 
 type MasteryResult struct {
@@ -28,16 +40,84 @@ type CFSubmission struct {
 	Verdict string `json:"verdict"`
 	Problem models.CFProblem `json:"problem"`
 	CreationTimeSeconds int64 `json:"creationTimeSeconds"`
+	RelativeTimeSeconds int64 `json:"relativeTimeSeconds"` //from the participant's contest start; 2147483647 in practice
+	Author CFSubmissionAuthor `json:"author"`
+}
+
+type CFSubmissionAuthor struct {
+	ParticipantType string `json:"participantType"` //CONTESTANT, VIRTUAL, OUT_OF_COMPETITION, PRACTICE, ...
+	StartTimeSeconds int64 `json:"startTimeSeconds"`
+}
+
+type CFUser struct {
+	Handle string `json:"handle"`
+	FirstName string `json:"firstName"`
+	Rating int `json:"rating"`
+}
+
+type CFRatingChange struct {
+	ContestID int `json:"contestId"`
+	ContestName string `json:"contestName"`
+	Rank int `json:"rank"`
+	OldRating int `json:"oldRating"`
+	NewRating int `json:"newRating"`
+	RatingUpdateTimeSeconds int64 `json:"ratingUpdateTimeSeconds"`
+}
+
+type CFContest struct {
+	ID int `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Phase string `json:"phase"`
+	DurationSeconds int64 `json:"durationSeconds"`
+	StartTimeSeconds int64 `json:"startTimeSeconds"`
+}
+
+type CFProblemResult struct {
+	Points float64 `json:"points"`
+	RejectedAttemptCount int `json:"rejectedAttemptCount"`
+	BestSubmissionTimeSeconds int64 `json:"bestSubmissionTimeSeconds"`
 }
 
-type CFUserResponse struct {
-	Status string `json:"status"`
-	Result []CFSubmission `json:"result"`
+type CFRanklistRow struct {
+	Party struct {
+		ParticipantType string `json:"participantType"`
+	} `json:"party"`
+	ProblemResults []CFProblemResult `json:"problemResults"`
+}
+
+type CFStandings struct {
+	Contest CFContest `json:"contest"`
+	Problems []models.CFProblem `json:"problems"`
+	Rows []CFRanklistRow `json:"rows"`
 }
 
 type ProblemSolveInput struct {
 	ProblemID string `json:"problem_id"`
-    TimeSpentMinutes int `json:"time_spent_minutes"`
+    TimeSpentMinutes int `json:"time_spent_minutes"` //stored as reported, credited only when the solve is untimed
+}
+
+type RecommendOptions struct {
+	TargetInc int
+	K int
+	Diversity float64 //0 keeps pure rating order, 1 maximizes spread
+	Mode string //"all" requires every topic, "any" requires at least one
+	MinRating int //0 means target - 200
+	MaxRating int //0 means target + 200
+	Offset int
+	ExcludeTags []string
+	ExcludeEstimated bool
+	Filter ProblemFilter
+	Group []string //when set, recommend for these handles together instead of one handle
+	GroupTarget string //min, mean or max of the group's topic mastery; defaults to mean
+}
+
+//restricts problems by the contest they came from. zero values leave a field unfiltered
+type ProblemFilter struct {
+	Divisions []string //div1, div2, div3, div4, div1+2, educational, global, other
+	SinceYear int
+	Indexes []string //problem letters, e.g. A, B
+	Lang string //en or ru, "" for both
 }
 
 type CFProblemOutput struct {
@@ -45,6 +125,86 @@ type CFProblemOutput struct {
 	Name string `json:"name"`
 	Rating int `json:"rating"`
 	Tags []string `json:"tags"`
+	Estimated bool `json:"estimated"`
+	SolvedCount int `json:"solvedCount"`
+}
+
+type TopicComparison struct {
+	Topic string `json:"topic"`
+	Mastery map[string]MasteryResult `json:"mastery"` //keyed by handle
+	Leader string `json:"leader"`
+	Gap float64 `json:"gap"` //leader's current mastery minus the lowest
+}
+
+type Comparison struct {
+	Handles []string `json:"handles"`
+	Topics []TopicComparison `json:"topics"`
+	LargestGaps []TopicComparison `json:"largest_gaps"`
+	Exclusive map[string][]CFProblemOutput `json:"exclusive"` //problems only that handle has solved
+}
+
+type VirtualContestOptions struct {
+	Topics []string //empty picks the user's weakest topics
+	K int //number of problems, 5 to 7
+	Duration time.Duration
+}
+
+type VirtualContestProblem struct {
+	Label string `json:"label"` //A, B, ...
+	CFProblemOutput
+	SolvedAt *time.Time `json:"solvedAt"`
+	WrongAttempts int `json:"wrongAttempts"`
+	Minutes *int `json:"minutes"` //from contest start to the accepted submission
+}
+
+type VirtualContest struct {
+	ID int `json:"id"`
+	Handle string `json:"handle"`
+	Topics []string `json:"topics"`
+	StartAt time.Time `json:"startAt"`
+	EndAt time.Time `json:"endAt"`
+	Status string `json:"status"` //running until sync sees it past its end, then finished
+	Solved int `json:"solved"`
+	PenaltyMinutes int `json:"penaltyMinutes"` //icpc style: solve minute plus 20 per wrong attempt
+	Problems []VirtualContestProblem `json:"problems"`
+}
+
+type SolveSession struct {
+	ID int `json:"id"`
+	Handle string `json:"handle"`
+	ProblemID string `json:"problemId"`
+	StartedAt time.Time `json:"startedAt"`
+	PausedAt *time.Time `json:"pausedAt"` //set while paused
+	PausedSeconds int `json:"pausedSeconds"` //total of finished pauses
+	Status string `json:"status"` //active until sync sees the accepted submission
+	CompletedAt *time.Time `json:"completedAt"`
+	Minutes *int `json:"minutes"`
+}
+
+type CatalogQuery struct {
+	Text string
+	Tags []string
+	MinRating int
+	MaxRating int
+	SolvedBy string
+	UnsolvedBy string
+	Handle string //annotates each problem with this handle's status
+	Sort string //newest, oldest, rating, -rating, popular
+	Cursor string
+	Limit int
+	Filter ProblemFilter
+}
+
+type CatalogProblem struct {
+	ID string `json:"id"`
+	Name string `json:"name"`
+	Rating int `json:"rating"`
+	Tags []string `json:"tags"`
+	ContestID int `json:"contestId"`
+	Index string `json:"index"`
+	Estimated bool `json:"estimated"`
+	SolvedCount int `json:"solvedCount"`
+	Status string `json:"status,omitempty"`
 }
 
 type CFSolveOutput struct {
@@ -52,13 +212,73 @@ type CFSolveOutput struct {
 	Name string `json:"name"`
 	Rating int `json:"rating"`
 	Tags []string `json:"tags"`
+	SolvedAt time.Time `json:"solvedAt"` //last activity on the problem
+	Attempts int `json:"attempts"`
+	FirstAttemptAt *time.Time `json:"firstAttemptAt"`
+	AcceptedAt *time.Time `json:"acceptedAt"`
+	Verdicts map[string]int `json:"verdicts"`
+	TimeSpentMinutes int `json:"timeSpentMinutes"` //the time mastery credits
+	ReportedMinutes *int `json:"reportedMinutes"` //what the user entered, nil when left blank
+}
+
+type UpsolveOutput struct {
+	ID string `json:"id"`
+	Name string `json:"name"`
+	Rating int `json:"rating"`
+	Tags []string `json:"tags"`
+	ContestID int `json:"contestId"`
+	ContestName string `json:"contestName"`
+	TargetRating int `json:"targetRating"`
+	Estimated bool `json:"estimated"` //rating came from EstimateRating rather than codeforces
+}
+
+//a problem as stored in the problems table
+type CatalogRow struct {
+	ID string
+	Name string
+	Rating int
+	Tags []string
+	ContestID int
+	Index string
+	Estimated bool
+	Lang string
+	SolvedCount int
+}
+
+type RefreshSummary struct {
+	Inserted int `json:"inserted"`
+	Updated int `json:"updated"`
+	RebuiltUsers int `json:"rebuiltUsers"`
+}
+
+type SolveEvent struct {
+	ProblemID string `json:"problemId"`
+	Name string `json:"name"`
+	Rating int `json:"rating"`
+	Estimated bool `json:"estimated"`
+	Attempts int `json:"attempts"`
+	TimeSpentMinutes int `json:"timeSpentMinutes"` //contest solves: since the previous accepted problem, not the contest start
 	SolvedAt time.Time `json:"solvedAt"`
+	Source string `json:"source"`
+}
+
+type TopicVerdicts struct {
+	Topic string `json:"topic"`
+	Counts map[string]int `json:"counts"` //OK, WA, TLE, MLE, RE, HACKED, CE, OTHER
+	Judged int `json:"judged"`
+	FailureRate float64 `json:"failureRate"`
+	MostCommonFailure string `json:"mostCommonFailure,omitempty"`
 }
 
 type ProblemUpsert struct {
 	ProblemID string
 	Status string
 	T time.Time
+	Attempts int
+	FirstAttemptAt *time.Time
+	SolvedAt *time.Time
+	Verdicts map[string]int
+	TimeSpentMinutes int //0 when sync has no timing for the solve
 }
 
 type BinKey struct {
@@ -67,6 +287,5 @@ type BinKey struct {
 }
 
 type BinAgg struct {
-	Credits []float64
-	Multipliers []float64
+	Solves []SolveAttributes
 }
\ No newline at end of file
@@ -0,0 +1,176 @@
+package mastery
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//how many of the user's most recent rated contests are scanned for unsolved problems
+const upsolveContestWindow = 10
+
+type standingsKey struct {
+	contestID int
+	handle string
+}
+
+//a finished contest's standings never change, so each handle's row is fetched from codeforces once.
+//every call holds the client's rate limit, which would otherwise stall everyone else's sync
+type standingsCache struct {
+	mu sync.Mutex
+	entries map[standingsKey]CFStandings
+}
+
+func newStandingsCache() *standingsCache {
+	return &standingsCache{entries: make(map[standingsKey]CFStandings)}
+}
+
+func (c *standingsCache) get(cf CFClient, contestID int, handle string) (CFStandings, error) {
+	key := standingsKey{contestID: contestID, handle: strings.ToLower(handle)}
+	c.mu.Lock()
+	standings, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok {
+		return standings, nil
+	}
+
+	standings, err := cf.ContestStandings(contestID, handle)
+	if err != nil {
+		return standings, err
+	}
+	c.mu.Lock()
+	c.entries[key] = standings
+	c.mu.Unlock()
+	return standings, nil
+}
+
+//builds the upsolve list from the contests a user took part in: problems they left unsolved,
+//closest to their mastery in the problem's topics first
+func getUpsolveQueue(conn *pgxpool.Pool, cf CFClient, cache *standingsCache, handle string, tagMap map[string]string, k int) ([]UpsolveOutput, error) {
+	changes, err := cf.UserRating(handle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch contest history: %w", err)
+	}
+
+	sort.Slice(changes, func(i int, j int) bool {
+		return changes[i].RatingUpdateTimeSeconds > changes[j].RatingUpdateTimeSeconds
+	})
+	if len(changes) > upsolveContestWindow {
+		changes = changes[:upsolveContestWindow]
+	}
+
+	stats, err := getAllStats(conn, handle)
+	if err != nil {
+		return nil, err
+	}
+
+	//anything solved after the contest (synced or submitted) is already upsolved
+	solved := make(map[string]bool)
+	rows, err := conn.Query(context.Background(), "SELECT problem_id FROM user_problems WHERE handle = $1 AND status = 'solved'", handle)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		solved[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var queue []UpsolveOutput
+	for _, change := range changes {
+		standings, err := cache.get(cf, change.ContestID, handle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch standings for contest %d: %w", change.ContestID, err)
+		}
+
+		var results []CFProblemResult
+		for _, row := range standings.Rows {
+			if row.Party.ParticipantType == "CONTESTANT" {
+				results = row.ProblemResults
+				break
+			}
+		}
+
+		for i, p := range standings.Problems {
+			id := fmt.Sprintf("%d%s", p.ContestID, p.Index)
+			if solved[id] {
+				continue
+			}
+			if i < len(results) && results[i].Points > 0 {
+				continue
+			}
+
+			topics := getTopicSlugs(p.Tags, tagMap)
+			if len(topics) == 0 {
+				continue
+			}
+
+			queue = append(queue, UpsolveOutput{
+				ID: id,
+				Name: p.Name,
+				Rating: p.Rating,
+				Tags: topics,
+				ContestID: change.ContestID,
+				ContestName: change.ContestName,
+				TargetRating: getUpsolveTarget(topics, stats),
+			})
+		}
+	}
+
+	//fresh contests aren't rated yet, which is exactly when upsolving matters, so use the estimate
+	var unrated []string
+	for _, p := range queue {
+		if p.Rating == 0 {
+			unrated = append(unrated, p.ID)
+		}
+	}
+	estimated, err := loadEstimatedRatings(conn, unrated)
+	if err != nil {
+		return nil, err
+	}
+	rated := queue[:0]
+	for _, p := range queue {
+		if rating, ok := estimated[p.ID]; ok && p.Rating == 0 {
+			p.Rating, p.Estimated = rating, true
+		}
+		if p.Rating > 0 {
+			rated = append(rated, p)
+		}
+	}
+	queue = rated
+
+	sort.SliceStable(queue, func(i int, j int) bool {
+		di := math.Abs(float64(queue[i].Rating - queue[i].TargetRating))
+		dj := math.Abs(float64(queue[j].Rating - queue[j].TargetRating))
+		if di != dj {
+			return di < dj
+		}
+		return queue[i].Rating < queue[j].Rating
+	})
+
+	if len(queue) > k {
+		queue = queue[:k]
+	}
+	return queue, nil
+}
+
+//mean mastery across a problem's topics, floored at 800 like the recommender
+func getUpsolveTarget(topics []string, stats map[string]MasteryResult) int {
+	var sum float64
+	for _, topic := range topics {
+		sum += math.Max(stats[topic].Current, 800)
+	}
+	return int(sum / float64(len(topics)))
+}
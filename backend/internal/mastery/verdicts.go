@@ -0,0 +1,89 @@
+package mastery
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//short names for the verdicts worth reporting. anything else is grouped under OTHER
+var verdictGroups = map[string]string{
+	"OK": "OK",
+	"WRONG_ANSWER": "WA",
+	"TIME_LIMIT_EXCEEDED": "TLE",
+	"MEMORY_LIMIT_EXCEEDED": "MLE",
+	"RUNTIME_ERROR": "RE",
+	"CHALLENGED": "HACKED",
+	"COMPILATION_ERROR": "CE",
+}
+
+//topics need this many judged submissions before their failure rate is trusted
+const minVerdictSample = 5
+
+//aggregates every attempted problem's verdict counts onto its topics
+func getVerdictStats(conn *pgxpool.Pool, handle string) ([]TopicVerdicts, error) {
+	rows, err := conn.Query(context.Background(), `
+		SELECT t.topic, v.verdict, SUM(v.count::int)
+		FROM user_problems up
+		JOIN problems p ON p.problem_id = up.problem_id
+		CROSS JOIN LATERAL UNNEST(p.tags) AS t(topic)
+		CROSS JOIN LATERAL jsonb_each_text(up.verdicts) AS v(verdict, count)
+		WHERE up.handle = $1 AND up.status <> 'excluded'
+		GROUP BY t.topic, v.verdict
+	`, handle)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byTopic := make(map[string]*TopicVerdicts)
+	for rows.Next() {
+		var topic, verdict string
+		var count int
+		if err := rows.Scan(&topic, &verdict, &count); err != nil {
+			return nil, err
+		}
+		tv := byTopic[topic]
+		if tv == nil {
+			tv = &TopicVerdicts{Topic: topic, Counts: make(map[string]int)}
+			byTopic[topic] = tv
+		}
+		group, ok := verdictGroups[verdict]
+		if !ok {
+			group = "OTHER"
+		}
+		tv.Counts[group] += count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	out := make([]TopicVerdicts, 0, len(byTopic))
+	for _, tv := range byTopic {
+		var failed, worst int
+		for group, count := range tv.Counts {
+			if group == "OK" || group == "CE" || group == "OTHER" {
+				continue
+			}
+			failed += count
+			if count > worst || (count == worst && group < tv.MostCommonFailure) {
+				worst = count
+				tv.MostCommonFailure = group
+			}
+		}
+		tv.Judged = failed + tv.Counts["OK"]
+		if tv.Judged >= minVerdictSample {
+			tv.FailureRate = float64(failed) / float64(tv.Judged)
+		}
+		out = append(out, *tv)
+	}
+
+	sort.Slice(out, func(i int, j int) bool {
+		if out[i].FailureRate != out[j].FailureRate {
+			return out[i].FailureRate > out[j].FailureRate
+		}
+		return out[i].Topic < out[j].Topic
+	})
+	return out, nil
+}
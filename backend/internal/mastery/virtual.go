@@ -0,0 +1,345 @@
+package mastery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	virtualWeakTopics = 3 //topics auto-selected when none are requested
+	virtualLadderSpan = 600 //rating distance from the first problem to the last
+	virtualWrongPenalty = 20 //penalty minutes per rejected attempt on a solved problem
+)
+
+var (
+	ErrContestRunning = errors.New("a virtual contest is already running for this handle")
+	ErrContestNotFound = errors.New("virtual contest not found")
+	ErrUnknownTopic = errors.New("unknown topic")
+)
+
+//builds a contest of opts.K problems climbing from 200 below the user's level in the chosen
+//topics to 400 above it, skipping anything the user has solved or tried, and starts it now
+func createVirtualContest(conn *pgxpool.Pool, handle string, opts VirtualContestOptions, tagMap map[string]string) (VirtualContest, error) {
+	var running bool
+	err := conn.QueryRow(context.Background(), `
+		SELECT EXISTS (SELECT 1 FROM virtual_contests WHERE handle = $1 AND end_at > $2)
+	`, handle, time.Now().UTC()).Scan(&running)
+	if err != nil {
+		return VirtualContest{}, err
+	}
+	if running {
+		return VirtualContest{}, ErrContestRunning
+	}
+
+	ratings, err := getGroupRatings(conn, []string{handle}, "")
+	if err != nil {
+		return VirtualContest{}, err
+	}
+
+	topics := opts.Topics
+	if len(topics) == 0 {
+		topics = getWeakestTopics(ratings, tagMap, virtualWeakTopics)
+	} else if err := checkTopics(conn, topics); err != nil {
+		return VirtualContest{}, err
+	}
+
+	base := max(getCombinedRating(topics, ratings), 800)
+	chosen := make([]CFProblemOutput, 0, opts.K)
+	picked := make(map[string]bool)
+	for i := 0; i < opts.K; i++ {
+		step := 0
+		if opts.K > 1 {
+			step = i * virtualLadderSpan / (opts.K - 1)
+		}
+		target := int(math.Round(float64(base-200+step)/100)) * 100
+		target = min(max(target, 800), 3500)
+
+		p, err := pickVirtualProblem(conn, handle, topics[i%len(topics)], target, picked)
+		if err != nil {
+			return VirtualContest{}, err
+		}
+		chosen = append(chosen, p)
+		picked[p.ID] = true
+	}
+
+	//a ladder reads easiest first even when a fallback pick landed out of order
+	sort.SliceStable(chosen, func(i, j int) bool { return chosen[i].Rating < chosen[j].Rating })
+
+	start := time.Now().UTC()
+	vc := VirtualContest{
+		Handle: handle,
+		Topics: topics,
+		StartAt: start,
+		EndAt: start.Add(opts.Duration),
+		Status: "running",
+	}
+
+	tx, err := conn.Begin(context.Background())
+	if err != nil {
+		return vc, err
+	}
+	defer tx.Rollback(context.Background())
+
+	err = tx.QueryRow(context.Background(), `
+		INSERT INTO virtual_contests (handle, topics, start_at, end_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, handle, topics, vc.StartAt, vc.EndAt).Scan(&vc.ID)
+	if err != nil {
+		return vc, err
+	}
+
+	var b pgx.Batch
+	for i, p := range chosen {
+		b.Queue(`
+			INSERT INTO virtual_contest_problems (contest_id, position, problem_id) VALUES ($1, $2, $3)
+		`, vc.ID, i, p.ID)
+		vc.Problems = append(vc.Problems, VirtualContestProblem{Label: contestLabel(i), CFProblemOutput: p})
+	}
+	if err := tx.SendBatch(context.Background(), &b).Close(); err != nil {
+		return vc, err
+	}
+
+	return vc, tx.Commit(context.Background())
+}
+
+//every requested topic must be a row in topics, otherwise the picks would silently fall back to any topic
+func checkTopics(conn *pgxpool.Pool, topics []string) error {
+	rows, err := conn.Query(context.Background(), "SELECT slug FROM topics WHERE slug = ANY($1)", topics)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	known := make(map[string]bool, len(topics))
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return err
+		}
+		known[slug] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, topic := range topics {
+		if !known[topic] {
+			return fmt.Errorf("%w: %s", ErrUnknownTopic, topic)
+		}
+	}
+	return nil
+}
+
+//lowest current mastery first, ties broken by name so the pick is stable
+func getWeakestTopics(ratings map[string]int, tagMap map[string]string, n int) []string {
+	topics := make([]string, 0)
+	for topic := range getTopics(tagMap) {
+		topics = append(topics, topic)
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		if ratings[topics[i]] != ratings[topics[j]] {
+			return ratings[topics[i]] < ratings[topics[j]]
+		}
+		return topics[i] < topics[j]
+	})
+	return topics[:min(n, len(topics))]
+}
+
+//closest rated english problem to target in the topic, widening to any topic when the topic runs dry
+func pickVirtualProblem(conn *pgxpool.Pool, handle string, topic string, target int, picked map[string]bool) (CFProblemOutput, error) {
+	exclude := make([]string, 0, len(picked))
+	for id := range picked {
+		exclude = append(exclude, id)
+	}
+
+	for _, tags := range [][]string{{topic}, {}} {
+		var p CFProblemOutput
+		err := conn.QueryRow(context.Background(), `
+			SELECT problem_id, name, rating, tags, estimated, solved_count
+			FROM problems p
+			WHERE tags @> $1::text[]
+			AND rating BETWEEN $2 - 100 AND $2 + 100
+			AND NOT estimated
+			AND NOT gym
+			AND lang = 'en'
+			AND NOT (problem_id = ANY($4))
+			AND NOT EXISTS (
+				SELECT 1 FROM user_problems up
+				WHERE up.handle = $3 AND up.problem_id = p.problem_id
+			)
+			ORDER BY ABS(rating - $2), RANDOM()
+			LIMIT 1
+		`, tags, target, handle, exclude).Scan(&p.ID, &p.Name, &p.Rating, &p.Tags, &p.Estimated, &p.SolvedCount)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return p, err
+		}
+		return p, nil
+	}
+	return CFProblemOutput{}, fmt.Errorf("no unsolved problem near rating %d", target)
+}
+
+func contestLabel(position int) string {
+	return string(rune('A' + position))
+}
+
+func listVirtualContests(conn *pgxpool.Pool, handle string) ([]VirtualContest, error) {
+	return loadVirtualContests(conn, handle, 0)
+}
+
+func getVirtualContest(conn *pgxpool.Pool, handle string, id int) (VirtualContest, error) {
+	contests, err := loadVirtualContests(conn, handle, id)
+	if err != nil {
+		return VirtualContest{}, err
+	}
+	if len(contests) == 0 {
+		return VirtualContest{}, ErrContestNotFound
+	}
+	return contests[0], nil
+}
+
+type queryer interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+//a handle's contests with their problems, newest first. id 0 loads all of them
+func loadVirtualContests(q queryer, handle string, id int) ([]VirtualContest, error) {
+	rows, err := q.Query(context.Background(), `
+		SELECT vc.id, vc.topics, vc.start_at, vc.end_at, vc.status, vc.solved, vc.penalty_minutes,
+		       vp.position, vp.problem_id, COALESCE(p.name, ''), COALESCE(p.rating, 0), COALESCE(p.tags, '{}'),
+		       COALESCE(p.estimated, FALSE), COALESCE(p.solved_count, 0),
+		       vp.solved_at, vp.wrong_attempts, vp.minutes
+		FROM virtual_contests vc
+		JOIN virtual_contest_problems vp ON vp.contest_id = vc.id
+		LEFT JOIN problems p ON p.problem_id = vp.problem_id
+		WHERE vc.handle = $1 AND ($2 = 0 OR vc.id = $2)
+		ORDER BY vc.start_at DESC, vc.id DESC, vp.position
+	`, handle, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contests := []VirtualContest{}
+	for rows.Next() {
+		var vc VirtualContest
+		var vp VirtualContestProblem
+		var position int
+		if err := rows.Scan(&vc.ID, &vc.Topics, &vc.StartAt, &vc.EndAt, &vc.Status, &vc.Solved, &vc.PenaltyMinutes,
+			&position, &vp.ID, &vp.Name, &vp.Rating, &vp.Tags, &vp.Estimated, &vp.SolvedCount,
+			&vp.SolvedAt, &vp.WrongAttempts, &vp.Minutes); err != nil {
+			return nil, err
+		}
+		vp.Label = contestLabel(position)
+
+		if n := len(contests); n == 0 || contests[n-1].ID != vc.ID {
+			vc.Handle = handle
+			contests = append(contests, vc)
+		}
+		last := &contests[len(contests)-1]
+		last.Problems = append(last.Problems, vp)
+	}
+	return contests, rows.Err()
+}
+
+//scores the handle's running contests from its codeforces submissions and closes the ones past
+//their end. returns the minutes since the previous solve for every problem solved inside a
+//contest window, which sync uses as the solve time
+func scoreVirtualContests(tx pgx.Tx, handle string, submissions []CFSubmission) (map[string]int, error) {
+	contests, err := loadVirtualContests(tx, handle, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	minutes := make(map[string]int)
+	var b pgx.Batch
+	for _, vc := range contests {
+		if vc.Status == "running" {
+			vc.Solved, vc.PenaltyMinutes = 0, 0
+			for i := range vc.Problems {
+				vp := &vc.Problems[i]
+				scoreVirtualProblem(vp, vc.StartAt, vc.EndAt, submissions)
+				b.Queue(`
+					UPDATE virtual_contest_problems
+					SET solved_at = $3, wrong_attempts = $4, minutes = $5
+					WHERE contest_id = $1 AND position = $2
+				`, vc.ID, i, vp.SolvedAt, vp.WrongAttempts, vp.Minutes)
+				if vp.Minutes != nil {
+					vc.Solved++
+					vc.PenaltyMinutes += *vp.Minutes + virtualWrongPenalty*vp.WrongAttempts
+				}
+			}
+
+			status := "running"
+			if now.After(vc.EndAt) {
+				status = "finished"
+			}
+			b.Queue(`
+				UPDATE virtual_contests SET status = $2, solved = $3, penalty_minutes = $4 WHERE id = $1
+			`, vc.ID, status, vc.Solved, vc.PenaltyMinutes)
+		}
+
+		//penalty counts from the start, but credit only gets the time since the previous solve
+		solved := make([]VirtualContestProblem, 0, len(vc.Problems))
+		for _, vp := range vc.Problems {
+			if vp.SolvedAt != nil {
+				solved = append(solved, vp)
+			}
+		}
+		sort.Slice(solved, func(i, j int) bool { return solved[i].SolvedAt.Before(*solved[j].SolvedAt) })
+		prev := vc.StartAt
+		for _, vp := range solved {
+			minutes[vp.ID] = gapMinutes(prev, *vp.SolvedAt)
+			prev = *vp.SolvedAt
+		}
+	}
+
+	if b.Len() > 0 {
+		if err := tx.SendBatch(context.Background(), &b).Close(); err != nil {
+			return nil, err
+		}
+	}
+	return minutes, nil
+}
+
+//finds the first accepted submission inside the window and the rejected ones before it.
+//compilation errors and skipped runs don't count against the user, as in summarizeAttempts
+func scoreVirtualProblem(vp *VirtualContestProblem, start time.Time, end time.Time, submissions []CFSubmission) {
+	var inWindow []CFSubmission
+	for _, s := range submissions {
+		if fmt.Sprintf("%d%s", s.Problem.ContestID, s.Problem.Index) != vp.ID {
+			continue
+		}
+		t := time.Unix(s.CreationTimeSeconds, 0).UTC()
+		if t.Before(start) || t.After(end) {
+			continue
+		}
+		inWindow = append(inWindow, s)
+	}
+	sort.Slice(inWindow, func(i, j int) bool {
+		return inWindow[i].CreationTimeSeconds < inWindow[j].CreationTimeSeconds
+	})
+
+	vp.SolvedAt, vp.Minutes, vp.WrongAttempts = nil, nil, 0
+	for _, s := range inWindow {
+		if s.Verdict == "OK" {
+			t := time.Unix(s.CreationTimeSeconds, 0).UTC()
+			m := max(1, int(math.Ceil(t.Sub(start).Minutes())))
+			vp.SolvedAt, vp.Minutes = &t, &m
+			return
+		}
+		if s.Verdict != "COMPILATION_ERROR" && s.Verdict != "SKIPPED" && s.Verdict != "TESTING" && s.Verdict != "" {
+			vp.WrongAttempts++
+		}
+	}
+}
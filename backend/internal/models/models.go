@@ -39,9 +39,18 @@ type CFProblem struct {
 	Tags []string `json:"tags"`
 }
 
+type CFProblemStatistics struct {
+	ContestID int `json:"contestId"`
+	Index string `json:"index"`
+	SolvedCount int `json:"solvedCount"`
+}
+
 type CFResponse struct {
 	Status string `json:"status"`
-	Result struct { Problems []CFProblem `json:"problems"`} `json:"result"`
+	Result struct {
+		Problems []CFProblem `json:"problems"`
+		ProblemStatistics []CFProblemStatistics `json:"problemStatistics"`
+	} `json:"result"`
 }
 
 type Node struct {